@@ -0,0 +1,104 @@
+package httph
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/paulfdunn/logh"
+)
+
+const (
+	// autoscaleWindow is the number of results between concurrency adjustments.
+	autoscaleWindow = 20
+	// Above autoscaleDecreaseRate errors the concurrency is halved; below autoscaleIncreaseRate
+	// it is increased by 1.
+	autoscaleDecreaseRate = 0.2
+	autoscaleIncreaseRate = 0.05
+)
+
+// WithConcurrencyAutoscale - Adjust the number of parallel requests of a CollectURLs batch
+// between min and max (which is capped at the threads argument), based on the error rate, similar
+// to TCP congestion control. The batch starts at max; after every 20 results, if more than 20% were
+// errors (Err set, StatusTooManyRequests, or a 5xx status) the concurrency is halved, and if fewer
+// than 5% were errors it is increased by 1.
+func WithConcurrencyAutoscale(min, max int) Option {
+	return func(o *options) {
+		o.autoscaleMin = min
+		o.autoscaleMax = max
+	}
+}
+
+// autoscaler - Limits the number of active requests to limit, adjusting limit based on results.
+type autoscaler struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	min    int
+	max    int
+	limit  int
+	active int
+	// results and errors since the last adjustment
+	results int
+	errors  int
+}
+
+// newAutoscaler - Return an autoscaler per the options, or nil if autoscaling is not enabled.
+func newAutoscaler(o *options, threads int) *autoscaler {
+	if o.autoscaleMax <= 0 {
+		return nil
+	}
+	as := &autoscaler{min: o.autoscaleMin, max: o.autoscaleMax}
+	if as.max > threads {
+		as.max = threads
+	}
+	if as.min < 1 {
+		as.min = 1
+	}
+	if as.min > as.max {
+		as.min = as.max
+	}
+	as.limit = as.max
+	as.cond = sync.NewCond(&as.mu)
+	return as
+}
+
+// acquire - Block until fewer than limit requests are active.
+func (as *autoscaler) acquire() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	for as.active >= as.limit {
+		as.cond.Wait()
+	}
+	as.active++
+}
+
+// release - Record the result of a request started with acquire, and adjust the limit.
+func (as *autoscaler) release(ucd URLCollectionData) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.active--
+	as.results++
+	if ucd.Err != nil || (ucd.Response != nil &&
+		(ucd.Response.StatusCode == http.StatusTooManyRequests || ucd.Response.StatusCode >= 500)) {
+		as.errors++
+	}
+
+	if as.results >= autoscaleWindow {
+		rate := float64(as.errors) / float64(as.results)
+		limit := as.limit
+		switch {
+		case rate > autoscaleDecreaseRate:
+			limit = as.limit / 2
+			if limit < as.min {
+				limit = as.min
+			}
+		case rate < autoscaleIncreaseRate && as.limit < as.max:
+			limit = as.limit + 1
+		}
+		if limit != as.limit {
+			logh.Map[appName].Printf(logh.Info, "CollectURLs error rate:%.2f, concurrency %d -> %d", rate, as.limit, limit)
+			as.limit = limit
+		}
+		as.results, as.errors = 0, 0
+	}
+	as.cond.Broadcast()
+}
@@ -0,0 +1,73 @@
+package httph
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAutoscaler(t *testing.T) {
+	as := newAutoscaler(&options{autoscaleMin: 2, autoscaleMax: 16}, 8)
+	if as.limit != 8 || as.min != 2 {
+		t.Errorf("Expected limit 8, min 2, got %d, %d", as.limit, as.min)
+	}
+
+	record := func(n int, err error) {
+		for i := 0; i < n; i++ {
+			as.acquire()
+			as.release(URLCollectionData{Err: err})
+		}
+	}
+	fail := errors.New("fail")
+	for _, expected := range []int{4, 2, 2} {
+		record(autoscaleWindow, fail)
+		if as.limit != expected {
+			t.Errorf("Expected limit %d, got %d", expected, as.limit)
+		}
+	}
+	for _, expected := range []int{3, 4} {
+		record(autoscaleWindow, nil)
+		if as.limit != expected {
+			t.Errorf("Expected limit %d, got %d", expected, as.limit)
+		}
+	}
+
+	if newAutoscaler(&options{}, 8) != nil {
+		t.Errorf("Expected nil autoscaler when not enabled")
+	}
+}
+
+func TestCollectURLsConcurrencyAutoscale(t *testing.T) {
+	var active, maxActive int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		if r.URL.Path == "/late" {
+			for m := atomic.LoadInt32(&maxActive); a > m && !atomic.CompareAndSwapInt32(&maxActive, m, a); {
+				m = atomic.LoadInt32(&maxActive)
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// After several windows of errors, concurrency is at the minimum.
+	var urls []string
+	for i := 0; i < 4*autoscaleWindow; i++ {
+		urls = append(urls, server.URL)
+	}
+	for i := 0; i < autoscaleWindow; i++ {
+		urls = append(urls, server.URL+"/late")
+	}
+	ucds := CollectURLs(urls, 1*time.Second, http.MethodGet, 8, WithConcurrencyAutoscale(1, 8))
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+	}
+	if m := atomic.LoadInt32(&maxActive); m > 1 {
+		t.Errorf("Expected concurrency 1, got %d", m)
+	}
+}
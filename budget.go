@@ -0,0 +1,61 @@
+package httph
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrByteBudget is the Err of URLs skipped by CollectURLsWithinBudget.
+	ErrByteBudget = errors.New("skipped for byte budget")
+)
+
+// CollectURLsWithinBudget - Collect URLs in two phases, to limit the bytes transferred: first
+// MethodHead is used for all urls to get their Content-Length, then MethodGet is used for the
+// urls whose bodies fit within budget bytes in total. urls are selected greedily in the order
+// given, so order urls by priority; a URL that does not fit is skipped, and later smaller URLs
+// may still be selected.
+// fetched are the MethodGet results. skipped are the MethodHead results of the other urls: Err is
+// the error if the request failed, ErrUnexpectedStatus if the status was not 2xx, or
+// ErrByteBudget if the response had no Content-Length, or the body did not fit. The budget
+// relies on the Content-Length reported by the server; use WithMaxBodySize to also bound each
+// body read.
+func CollectURLsWithinBudget(urls []string, timeout time.Duration, threads int, budget int64,
+	opts ...Option) (fetched []URLCollectionData, skipped []URLCollectionData) {
+	heads := map[string]URLCollectionData{}
+	for _, ucd := range CollectURLs(urls, timeout, http.MethodHead, threads, opts...) {
+		heads[ucd.URL] = ucd
+	}
+
+	var selected []string
+	for _, u := range urls {
+		ucd, ok := heads[u]
+		if !ok {
+			// A duplicate URL that was already selected or skipped.
+			continue
+		}
+		delete(heads, u)
+		switch {
+		case ucd.Err != nil:
+		case ucd.Response.StatusCode < 200 || ucd.Response.StatusCode > 299:
+			ucd.Err = fmt.Errorf("%w: %d", ErrUnexpectedStatus, ucd.Response.StatusCode)
+		case ucd.Response.ContentLength < 0:
+			ucd.Err = fmt.Errorf("%w: unknown content length", ErrByteBudget)
+		case ucd.Response.ContentLength > budget:
+			ucd.Err = fmt.Errorf("%w: content length %d > remaining budget %d", ErrByteBudget,
+				ucd.Response.ContentLength, budget)
+		default:
+			budget -= ucd.Response.ContentLength
+			selected = append(selected, u)
+			continue
+		}
+		skipped = append(skipped, ucd)
+	}
+
+	if len(selected) > 0 {
+		fetched = CollectURLs(selected, timeout, http.MethodGet, threads, opts...)
+	}
+	return fetched, skipped
+}
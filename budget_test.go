@@ -0,0 +1,65 @@
+package httph
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLsWithinBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+			w.Write([]byte("unknown"))
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.Header().Set("Content-Length", "5")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		size, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		if r.Method == http.MethodGet {
+			w.Write([]byte(strings.Repeat("a", size)))
+		}
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/60", server.URL + "/50", server.URL + "/chunked", server.URL + "/missing", server.URL + "/30",
+		server.URL + "/10", server.URL + "/0"}
+	fetched, skipped := CollectURLsWithinBudget(urls, 1*time.Second, 2, 100)
+
+	var fetchedURLs []string
+	for _, ucd := range fetched {
+		size, _ := strconv.Atoi(strings.TrimPrefix(ucd.URL, server.URL+"/"))
+		if ucd.Err != nil || len(ucd.Bytes) != size {
+			t.Errorf("Unexpected fetch of %s, got %d bytes, error: %v", ucd.URL, len(ucd.Bytes), ucd.Err)
+		}
+		fetchedURLs = append(fetchedURLs, ucd.URL)
+	}
+	sort.Strings(fetchedURLs)
+	// An empty body fits.
+	expected := []string{server.URL + "/0", server.URL + "/10", server.URL + "/30", server.URL + "/60"}
+	if strings.Join(fetchedURLs, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected fetched %v, got %v", expected, fetchedURLs)
+	}
+
+	if len(skipped) != 3 || skipped[0].URL != urls[1] || skipped[1].URL != urls[2] || skipped[2].URL != urls[3] {
+		t.Errorf("Expected skipped %v, got %+v", urls[1:4], skipped)
+	}
+	for i, ucd := range skipped {
+		expected := ErrByteBudget
+		if i == 2 {
+			expected = ErrUnexpectedStatus
+		}
+		if !errors.Is(ucd.Err, expected) || ucd.Response.Request.Method != http.MethodHead {
+			t.Errorf("Expected %v for HEAD of %s, got %v", expected, ucd.URL, ucd.Err)
+		}
+	}
+}
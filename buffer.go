@@ -0,0 +1,42 @@
+package httph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CollectURLInto - Same as CollectURL, but the body is read into buf, to avoid allocating a
+// new slice for each request. The returned body is buf[:n] when the body fits in cap(buf);
+// otherwise a larger slice is allocated, as with append, and the caller may keep it as the buf
+// for the next call. The returned body aliases buf: it is only valid until buf is reused or
+// modified, so copy it first if it must be retained.
+func CollectURLInto(buf []byte, urlIn string, timeout time.Duration, method string, opts ...Option) ([]byte, *http.Response, error) {
+	o := newOptions(opts)
+	o.readBuffer = buf
+	client := newClient(timeout, false, o)
+	// The client is not reused, so idle connections are closed.
+	defer client.CloseIdleConnections()
+	ucd := collectURL(context.Background(), client, urlIn, method, o)
+	return ucd.Bytes, ucd.Response, ucd.Err
+}
+
+// readAllInto - Same as io.ReadAll, but reads into buf[:0], growing it only when full.
+func readAllInto(buf []byte, r io.Reader) ([]byte, error) {
+	b := buf[:0]
+	for {
+		if len(b) == cap(b) {
+			// Let append choose the new capacity.
+			b = append(b, 0)[:len(b)]
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return b, err
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package httph
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLInto(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	buf := make([]byte, 0, 2*len(data))
+	value, _, err := CollectURLInto(buf, server.URL, 1*time.Second, http.MethodGet)
+	if err != nil || !bytes.Equal(value, data) || &value[:1][0] != &buf[:1][0] {
+		t.Errorf("Expected body read into buf, error: %v", err)
+	}
+
+	// A buffer that is too small is grown.
+	small := make([]byte, 0, 10)
+	value, _, err = CollectURLInto(small, server.URL, 1*time.Second, http.MethodGet)
+	if err != nil || !bytes.Equal(value, data) {
+		t.Errorf("Expected body read into grown buf, error: %v", err)
+	}
+
+	value, _, err = CollectURLInto(nil, server.URL, 1*time.Second, http.MethodGet)
+	if err != nil || !bytes.Equal(value, data) {
+		t.Errorf("Expected body read with nil buf, error: %v", err)
+	}
+}
+
+func benchmarkServer() *httptest.Server {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+}
+
+func BenchmarkCollectURL(b *testing.B) {
+	server := benchmarkServer()
+	defer server.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCollectURLInto(b *testing.B) {
+	server := benchmarkServer()
+	defer server.Close()
+	buf := make([]byte, 0, 128*1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, _, err = CollectURLInto(buf, server.URL, 1*time.Second, http.MethodGet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Collector - A Collector makes requests using a fixed set of Options, and tracks the
+// requests it has in flight so that they can be cancelled individually with Cancel, or
+// drained with Shutdown. A Collector is safe for concurrent use.
+type Collector struct {
+	o *options
+
+	mu       sync.Mutex
+	nextID   uint64
+	inFlight map[string]map[uint64]context.CancelFunc
+	// wg counts the requests in flight.
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+	// connStats are keyed by host.
+	connStats map[string]HostConnStats
+	sizes     sizeHistogram
+}
+
+// HostConnStats - Connection statistics for the requests to a host.
+type HostConnStats struct {
+	// Conns is the number of connections obtained for requests, new or reused.
+	Conns int64
+	// Reused is the number of Conns that were reused idle connections.
+	Reused int64
+}
+
+// ReuseRatio - The fraction of connections that were reused, or 0 if there were none.
+func (s HostConnStats) ReuseRatio() float64 {
+	if s.Conns == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(s.Conns)
+}
+
+var (
+	// ErrShutdown is returned for requests that were not started because Shutdown was called.
+	ErrShutdown = errors.New("collector shut down")
+)
+
+// NewCollector - Create a Collector; opts are applied to every request made by the Collector.
+func NewCollector(opts ...Option) *Collector {
+	return &Collector{o: newOptions(opts), inFlight: map[string]map[uint64]context.CancelFunc{},
+		shutdown: make(chan struct{}), connStats: map[string]HostConnStats{}}
+}
+
+// CollectURL - Same as the package level CollectURL, but the request can be cancelled with Cancel.
+func (c *Collector) CollectURL(urlIn string, timeout time.Duration, method string) ([]byte, *http.Response, error) {
+	client := newClient(timeout, false, c.o)
+	// The client is not reused, so idle connections are closed.
+	defer client.CloseIdleConnections()
+	ucd := c.collectURL(client, urlIn, method)
+	return ucd.Bytes, ucd.Response, ucd.Err
+}
+
+// CollectURLs - Same as the package level CollectURLs, but in flight requests can be cancelled
+// with Cancel.
+func (c *Collector) CollectURLs(urls []string, timeout time.Duration, method string, threads int) []URLCollectionData {
+	client := newClient(timeout, false, c.o)
+	return collectURLs(urls, threads, c.o, client, func(url string) URLCollectionData {
+		return c.collectURL(client, url, method)
+	})
+}
+
+// collectURL - Make a request that can be cancelled with Cancel.
+func (c *Collector) collectURL(client *http.Client, urlIn string, method string) URLCollectionData {
+	ctx, done, err := c.track(urlIn)
+	if err != nil {
+		return URLCollectionData{URL: urlIn, Err: err}
+	}
+	defer done()
+	// GetConn is called with the host:port actually requested, after WithURLRewrite or a redirect,
+	// before GotConn for the same connection.
+	var hostPort string
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hp string) {
+			hostPort = hp
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			stats := c.connStats[hostPort]
+			stats.Conns++
+			if info.Reused {
+				stats.Reused++
+			}
+			c.connStats[hostPort] = stats
+		},
+	})
+	ucd := collectURL(ctx, client, urlIn, method, c.o)
+	if ucd.Err == nil {
+		c.mu.Lock()
+		c.sizes.add(int64(len(ucd.Bytes)))
+		c.mu.Unlock()
+	}
+	return ucd
+}
+
+// SizePercentiles - Return the body size at each of percentiles (0 to 100), such as 50, 90, and
+// 99, of the successful requests made by the Collector; all are 0 if there were none. Sizes are
+// kept in a histogram with power of two buckets, so memory use is constant, and each returned
+// size is the upper bound of the bucket containing the percentile: the actual size is at most
+// the returned size, and more than half of it.
+func (c *Collector) SizePercentiles(percentiles ...float64) []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sizes := make([]int64, len(percentiles))
+	for i, p := range percentiles {
+		sizes[i] = c.sizes.percentile(p)
+	}
+	return sizes
+}
+
+// ConnStats - Return the connection statistics of the requests made by the Collector, keyed by
+// the host:port each request was sent to, which is the rewritten URL for WithURLRewrite, and the
+// redirect location for redirects. Connections are only reused with WithIdleConnTimeout; a low
+// HostConnStats.ReuseRatio otherwise indicates the host is closing connections.
+func (c *Collector) ConnStats() map[string]HostConnStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]HostConnStats, len(c.connStats))
+	for host, s := range c.connStats {
+		stats[host] = s
+	}
+	return stats
+}
+
+// Cancel - Cancel all in flight requests for urlIn; the Err of the cancelled requests will
+// satisfy errors.Is(err, context.Canceled). Requests that have not started are not affected.
+// Returns true if any request was cancelled.
+func (c *Collector) Cancel(urlIn string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cancels := c.inFlight[urlIn]
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels) > 0
+}
+
+// Shutdown - Stop the Collector: requests that have not started, including the remaining URLs
+// of running CollectURLs calls, return ErrShutdown, as do all later calls. Shutdown waits for in
+// flight requests to complete, until ctx is done, after which they are cancelled. Returns nil if
+// all in flight requests completed, or ctx.Err() if requests were cancelled.
+func (c *Collector) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	select {
+	case <-c.shutdown:
+	default:
+		close(c.shutdown)
+	}
+	c.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		for _, cancels := range c.inFlight {
+			for _, cancel := range cancels {
+				cancel()
+			}
+		}
+		c.mu.Unlock()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// track - Register a cancellable context for urlIn. The returned func must be called when the
+// request is complete. Returns ErrShutdown if Shutdown has been called.
+func (c *Collector) track(urlIn string) (context.Context, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.shutdown:
+		return nil, nil, ErrShutdown
+	default:
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.wg.Add(1)
+	id := c.nextID
+	c.nextID++
+	if c.inFlight[urlIn] == nil {
+		c.inFlight[urlIn] = map[uint64]context.CancelFunc{}
+	}
+	c.inFlight[urlIn][id] = cancel
+
+	return ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.inFlight[urlIn], id)
+		if len(c.inFlight[urlIn]) == 0 {
+			delete(c.inFlight, urlIn)
+		}
+		cancel()
+		c.wg.Done()
+	}, nil
+}
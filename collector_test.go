@@ -0,0 +1,184 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectorCancel(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := NewCollector()
+	if c.Cancel(server.URL + "/slow") {
+		t.Errorf("Cancel returned true with no requests in flight")
+	}
+	go func() {
+		<-started
+		if !c.Cancel(server.URL + "/slow") {
+			t.Errorf("Cancel returned false with a request in flight")
+		}
+	}()
+
+	urls := []string{server.URL + "/slow", server.URL + "/fast"}
+	ucds := c.CollectURLs(urls, 5*time.Second, http.MethodGet, 2)
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+		return
+	}
+	for _, ucd := range ucds {
+		switch ucd.URL {
+		case urls[0]:
+			if !errors.Is(ucd.Err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", ucd.Err)
+			}
+		case urls[1]:
+			if ucd.Err != nil {
+				t.Errorf("CollectURLs returned non-nil error: %v", ucd.Err)
+			}
+		}
+	}
+}
+
+func TestCollectorShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		if r.URL.Path == "/block" {
+			<-r.Context().Done()
+			return
+		}
+		select {
+		case <-release:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	// In flight requests complete before the deadline.
+	c := NewCollector()
+	go func() {
+		<-started
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		if err := c.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown returned non-nil error: %v", err)
+		}
+	}()
+	urls := []string{server.URL + "/0", server.URL + "/1", server.URL + "/2"}
+	ucds := c.CollectURLs(urls, 5*time.Second, http.MethodGet, 1)
+	for i, ucd := range ucds {
+		if i == 0 && (ucd.Err != nil || ucd.Response.StatusCode != http.StatusOK) {
+			t.Errorf("Expected completed result, got %+v", ucd)
+		}
+		if i > 0 && !errors.Is(ucd.Err, ErrShutdown) {
+			t.Errorf("Expected ErrShutdown, got %v", ucd.Err)
+		}
+	}
+	if _, _, err := c.CollectURL(server.URL, 5*time.Second, http.MethodGet); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Expected ErrShutdown, got %v", err)
+	}
+
+	// In flight requests are cancelled at the deadline.
+	c = NewCollector()
+	go func() {
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	}()
+	ucds = c.CollectURLs([]string{server.URL + "/block"}, 5*time.Second, http.MethodGet, 1)
+	if !errors.Is(ucds[0].Err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", ucds[0].Err)
+	}
+}
+
+func TestCollectorConnStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL, server.URL, server.URL, server.URL}
+	c := NewCollector(WithIdleConnTimeout(time.Second))
+	c.CollectURLs(urls, 1*time.Second, http.MethodGet, 1)
+	host := server.Listener.Addr().String()
+	stats := c.ConnStats()
+	if s := stats[host]; len(stats) != 1 || s.Conns != 4 || s.Reused != 3 || s.ReuseRatio() != 0.75 {
+		t.Errorf("Unexpected stats with keep-alive: %+v", stats)
+	}
+
+	c = NewCollector()
+	c.CollectURLs(urls, 1*time.Second, http.MethodGet, 1)
+	if s := c.ConnStats()[host]; s.Conns != 4 || s.Reused != 0 || s.ReuseRatio() != 0 {
+		t.Errorf("Unexpected stats without keep-alive: %+v", s)
+	}
+}
+
+func TestCollectorSizePercentiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Write(make([]byte, 10000))
+		case "/empty":
+		default:
+			w.Write(make([]byte, 100))
+		}
+	}))
+	defer server.Close()
+
+	c := NewCollector()
+	if sizes := c.SizePercentiles(50); sizes[0] != 0 {
+		t.Errorf("Expected 0 with no requests, got %v", sizes)
+	}
+	urls := []string{server.URL + "/large", server.URL + "/empty"}
+	for i := 0; i < 18; i++ {
+		urls = append(urls, server.URL)
+	}
+	c.CollectURLs(urls, 1*time.Second, http.MethodGet, 4)
+	// Sizes are reported as the upper bound of their power of two bucket.
+	expected := []int64{0, 127, 127, 16383}
+	sizes := c.SizePercentiles(0, 50, 90, 100)
+	for i := range expected {
+		if sizes[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, sizes)
+			break
+		}
+	}
+}
+
+func TestCollectorConnStatsURLRewrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rewrite := func(urlIn string) (string, error) {
+		return strings.Replace(urlIn, "http://production.example.com", server.URL, 1), nil
+	}
+	c := NewCollector(WithURLRewrite(rewrite))
+	c.CollectURLs([]string{"http://production.example.com/a"}, 1*time.Second, http.MethodGet, 1)
+	stats := c.ConnStats()
+	if s, ok := stats[server.Listener.Addr().String()]; len(stats) != 1 || !ok || s.Conns != 1 {
+		t.Errorf("Expected stats for the rewritten host, got %+v", stats)
+	}
+}
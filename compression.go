@@ -0,0 +1,96 @@
+package httph
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// WithCompressionReport - Record CompressedBytes and DecompressedBytes in URLCollectionData. The
+// automatic decompression normally done by http.Transport is done by httph instead, so the bytes
+// received can be counted. Response.Uncompressed is true when the response was compressed. This
+// option has no effect when automatic decompression is disabled, such as for
+// WithVerifyContentDigest or a WithTransport transport with DisableCompression set.
+func WithCompressionReport() Option {
+	return func(o *options) {
+		o.compressionReport = true
+	}
+}
+
+// compressionReportKey - The context key for the *compressionReportBody of a request; the
+// http.Client wraps Response.Body, so the body is not available from the response.
+type compressionReportKey struct{}
+
+// compressionReportTransport - An http.RoundTripper that requests gzip and decompresses
+// responses the same as http.Transport, while counting the compressed and decompressed bytes.
+// The wrapped transport must have DisableCompression set.
+type compressionReportTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *compressionReportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestedGzip := false
+	// The same conditions http.Transport uses to add Accept-Encoding.
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != http.MethodHead {
+		// A RoundTripper must not modify the request.
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+		requestedGzip = true
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body := &compressionReportBody{body: resp.Body, compressed: &countingReader{r: resp.Body}}
+	body.r = body.compressed
+	if requestedGzip && resp.Header.Get("Content-Encoding") == "gzip" && resp.Body != http.NoBody {
+		body.gzip = true
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = body
+	if report, ok := req.Context().Value(compressionReportKey{}).(**compressionReportBody); ok {
+		*report = body
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections - Forward to the wrapped RoundTripper, so http.Client.CloseIdleConnections works.
+func (t *compressionReportTransport) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// compressionReportBody - A response body that counts the bytes read from the connection,
+// compressed, and the bytes returned, decompressed. The gzip reader is created on the first
+// Read, as creating it reads the gzip header.
+type compressionReportBody struct {
+	body       io.ReadCloser
+	compressed *countingReader
+	gzip       bool
+	r          io.Reader
+	err        error
+	n          int64
+}
+
+func (b *compressionReportBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.gzip {
+		b.gzip = false
+		if b.r, b.err = gzip.NewReader(b.compressed); b.err != nil {
+			return 0, b.err
+		}
+	}
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *compressionReportBody) Close() error {
+	return b.body.Close()
+}
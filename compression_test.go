@@ -0,0 +1,53 @@
+package httph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLsCompressionReport(t *testing.T) {
+	data := strings.Repeat("compressible ", 1000)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(data))
+	zw.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gzip" && r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gz.Bytes())
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer server.Close()
+
+	ucds := CollectURLs([]string{server.URL + "/gzip", server.URL + "/plain"}, 1*time.Second, http.MethodGet, 2,
+		WithCompressionReport())
+	results := map[string]URLCollectionData{}
+	for _, ucd := range ucds {
+		results[ucd.URL] = ucd
+	}
+	ucd := results[server.URL+"/gzip"]
+	if ucd.Err != nil || string(ucd.Bytes) != data || !ucd.Response.Uncompressed ||
+		ucd.CompressedBytes != int64(gz.Len()) || ucd.DecompressedBytes != int64(len(data)) {
+		t.Errorf("Unexpected gzip result, compressed:%d, decompressed:%d, error: %v",
+			ucd.CompressedBytes, ucd.DecompressedBytes, ucd.Err)
+	}
+	ucd = results[server.URL+"/plain"]
+	if ucd.Err != nil || string(ucd.Bytes) != data || ucd.Response.Uncompressed ||
+		ucd.CompressedBytes != int64(len(data)) || ucd.DecompressedBytes != int64(len(data)) {
+		t.Errorf("Unexpected plain result, compressed:%d, decompressed:%d, error: %v",
+			ucd.CompressedBytes, ucd.DecompressedBytes, ucd.Err)
+	}
+
+	// Without the option, the transport decompresses and nothing is reported.
+	ucds = CollectURLs([]string{server.URL + "/gzip"}, 1*time.Second, http.MethodGet, 1)
+	if ucd = ucds[0]; ucd.Err != nil || string(ucd.Bytes) != data || ucd.CompressedBytes != 0 {
+		t.Errorf("Unexpected result without report, compressed:%d, error: %v", ucd.CompressedBytes, ucd.Err)
+	}
+}
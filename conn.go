@@ -0,0 +1,208 @@
+package httph
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// WithReadDeadlinePerChunk - Abort a request if any single read from the connection stalls for
+// longer than timeout. A read deadline is set on the connection before each Read, so unlike the
+// overall request timeout, a slow but steadily progressing response is not aborted.
+// The deadline only applies while a request is using the connection, from when the connection
+// is obtained until the response body is read to EOF or closed; idle keep-alive connections
+// are not affected, so WithIdleConnTimeout still controls how long they are kept.
+// The error returned for a stalled read satisfies net.Error with Timeout() true.
+func WithReadDeadlinePerChunk(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readDeadlinePerChunk = timeout
+	}
+}
+
+// deadlineConn - A net.Conn that sets a read deadline of timeout before each Read, while active.
+// net/http reads from idle pooled connections in the background, so idle connections must not
+// have a deadline.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+
+	mu     sync.Mutex
+	active bool
+	// gen is incremented each time the connection is activated, so a late deactivate by a
+	// previous request does not affect the current one.
+	gen uint64
+}
+
+func (dc *deadlineConn) Read(b []byte) (int, error) {
+	dc.mu.Lock()
+	if dc.active {
+		if err := dc.Conn.SetReadDeadline(time.Now().Add(dc.timeout)); err != nil {
+			dc.mu.Unlock()
+			return 0, err
+		}
+	}
+	dc.mu.Unlock()
+	return dc.Conn.Read(b)
+}
+
+// activate - Apply the deadline, including to a Read already in progress. Returns the value to
+// pass to deactivate.
+func (dc *deadlineConn) activate() uint64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.active = true
+	dc.gen++
+	dc.Conn.SetReadDeadline(time.Now().Add(dc.timeout))
+	return dc.gen
+}
+
+// deactivate - Remove the deadline, if the connection has not been activated again since gen.
+func (dc *deadlineConn) deactivate(gen uint64) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.gen != gen {
+		return
+	}
+	dc.active = false
+	dc.Conn.SetReadDeadline(time.Time{})
+}
+
+// deadlineTransport - An http.RoundTripper that activates the deadlineConn used for each
+// request, and deactivates it when the response body is done.
+type deadlineTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var dc *deadlineConn
+	var gen uint64
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c := info.Conn
+			if tc, ok := c.(*tls.Conn); ok {
+				c = tc.NetConn()
+			}
+			if dc, _ = c.(*deadlineConn); dc != nil {
+				gen = dc.activate()
+			}
+		},
+	}
+	resp, err := t.rt.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if dc == nil {
+		return resp, err
+	}
+	if err != nil || resp.Body == http.NoBody {
+		dc.deactivate(gen)
+		return resp, err
+	}
+	resp.Body = &deadlineBody{ReadCloser: resp.Body, done: func() { dc.deactivate(gen) }}
+	return resp, nil
+}
+
+// CloseIdleConnections - Forward to the wrapped RoundTripper, so http.Client.CloseIdleConnections works.
+func (t *deadlineTransport) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// deadlineBody - A response body that calls done at EOF or Close.
+type deadlineBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
+}
+
+// WithServerName - By default the TLS ServerName (SNI) of each connection is the host of the
+// request URL. serverNames maps a URL host name (without port) to the ServerName to send
+// instead, for cases where a virtual host is reached by a different name or IP address.
+// Certificate verification, when enabled, is done against the ServerName sent.
+func WithServerName(serverNames map[string]string) Option {
+	return func(o *options) {
+		o.serverNames = serverNames
+	}
+}
+
+// dialFunc - Return the transport's effective dial function.
+func dialFunc(tr *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if tr.DialContext != nil {
+		return tr.DialContext
+	}
+	if tr.Dial != nil {
+		d := tr.Dial
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d(network, addr)
+		}
+	}
+	return (&net.Dialer{}).DialContext
+}
+
+// setTLSDial - Replace the transport's TLS dial with one that sets the ServerName of each
+// connection from o.serverNames, or the host being dialed, and verifies the connection per
+// WithRootCAs and WithAcceptInvalidHostnames.
+func setTLSDial(tr *http.Transport, o *options) {
+	dial := dialFunc(tr)
+	tlsConfig := tr.TLSClientConfig
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := tlsConfig.Clone()
+		cfg.ServerName = host
+		if sn, ok := o.serverNames[host]; ok {
+			cfg.ServerName = sn
+		}
+		if o.verifyTLS {
+			// Verification is done by VerifyConnection, which knows the host being dialed.
+			dnsName := cfg.ServerName
+			if o.acceptInvalidHostnames[host] {
+				dnsName = ""
+			}
+			cfg.InsecureSkipVerify = true
+			cfg.VerifyConnection = verifyConnection(cfg.RootCAs, dnsName)
+		}
+		tc := tls.Client(c, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+// wrapDial - Replace the transport's dial function with one that wraps each new connection
+// with wrap.
+func wrapDial(tr *http.Transport, wrap func(net.Conn) net.Conn) {
+	dial := dialFunc(tr)
+	tr.Dial = nil
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return wrap(c), nil
+	}
+}
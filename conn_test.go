@@ -0,0 +1,101 @@
+package httph
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLReadDeadlinePerChunk(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	// Total time, about 500ms, exceeds the per chunk deadline, but no single read stalls.
+	value, _, err := CollectURL(server.URL, 5*time.Second, http.MethodGet, WithReadDeadlinePerChunk(200*time.Millisecond))
+	if err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+		return
+	}
+	if expected := strings.Repeat("chunk", 5); string(value) != expected {
+		t.Errorf("Expected %s, got %s", expected, value)
+	}
+
+	_, _, err = CollectURL(server.URL, 5*time.Second, http.MethodGet, WithReadDeadlinePerChunk(20*time.Millisecond))
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
+
+func TestCollectURLReadDeadlinePerChunkIdleConn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// PollURL reuses its client, and the connection is idle for longer than the per chunk
+	// deadline between polls.
+	var reused []bool
+	handler := func(ucd URLCollectionData) bool {
+		if ucd.Err != nil {
+			t.Errorf("Unexpected error: %v", ucd.Err)
+		}
+		for _, e := range ucd.ConnEvents {
+			if e.Type == ConnEventGotConn {
+				reused = append(reused, e.Reused)
+			}
+		}
+		return len(reused) < 2
+	}
+	err := PollURL(context.Background(), server.URL, 5*time.Second, "X-Missing", ParseDelay, 150*time.Millisecond,
+		handler, WithIdleConnTimeout(10*time.Second), WithReadDeadlinePerChunk(50*time.Millisecond), WithConnectionTrace())
+	if err != nil || len(reused) != 2 || reused[0] || !reused[1] {
+		t.Errorf("Expected the idle connection to be reused, got %v, error: %v", reused, err)
+	}
+}
+
+func TestCollectURLServerName(t *testing.T) {
+	serverNames := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+		serverNames <- chi.ServerName
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	// SNI is not sent for IP addresses, so use a host name.
+	u := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if _, _, err := CollectURL(u, 1*time.Second, http.MethodGet); err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+		return
+	}
+	if sn := <-serverNames; sn != "localhost" {
+		t.Errorf("Expected ServerName localhost, got %s", sn)
+	}
+
+	_, _, err := CollectURL(u, 1*time.Second, http.MethodGet,
+		WithServerName(map[string]string{"localhost": "vhost.example.com"}))
+	if err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+		return
+	}
+	if sn := <-serverNames; sn != "vhost.example.com" {
+		t.Errorf("Expected ServerName vhost.example.com, got %s", sn)
+	}
+}
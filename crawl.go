@@ -0,0 +1,128 @@
+package httph
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+// VisitedStore - The set of URLs visited by Crawl. The default is an in memory set; a shared
+// store (Redis, bolt, etc.) allows multiple crawlers to coordinate deduplication.
+// Crawl only calls a VisitedStore from a single goroutine.
+type VisitedStore interface {
+	// Seen returns true if url has been added.
+	Seen(url string) bool
+	// Add adds url to the set.
+	Add(url string)
+}
+
+// memoryVisitedStore - The default, in memory, VisitedStore.
+type memoryVisitedStore map[string]bool
+
+func (m memoryVisitedStore) Seen(url string) bool {
+	return m[url]
+}
+
+func (m memoryVisitedStore) Add(url string) {
+	m[url] = true
+}
+
+// WithCrawlVisitedStore - Use store as the set of URLs visited by Crawl. URLs already in store
+// when Crawl is called, including seeds, are not fetched.
+func WithCrawlVisitedStore(store VisitedStore) Option {
+	return func(o *options) {
+		o.crawlVisited = store
+	}
+}
+
+// WithCrawlMaxDepth - Limit Crawl to links at most depth hops from the seeds; seeds are depth 0.
+// depth < 0 means no limit (default).
+func WithCrawlMaxDepth(depth int) Option {
+	return func(o *options) {
+		o.crawlMaxDepth = depth
+	}
+}
+
+// WithCrawlMaxPages - Limit the total number of URLs fetched by Crawl.
+// pages <= 0 means no limit (default).
+func WithCrawlMaxPages(pages int) Option {
+	return func(o *options) {
+		o.crawlMaxPages = pages
+	}
+}
+
+// Crawl - Breadth first crawl starting at seeds. Each depth of the crawl is fetched with
+// CollectURLs using MethodGet, timeout, threads, and opts. extract is called with each
+// successful result and returns the links found in it; relative links are resolved against
+// the result URL, and fragments are removed. Each URL is fetched at most once; see
+// WithCrawlVisitedStore.
+// The crawl ends when there are no new links, or a WithCrawlMaxDepth/WithCrawlMaxPages limit
+// is reached. All results are returned.
+func Crawl(seeds []string, timeout time.Duration, threads int, extract func(ucd URLCollectionData) []string,
+	opts ...Option) []URLCollectionData {
+	o := newOptions(opts)
+	visited := o.crawlVisited
+	if visited == nil {
+		visited = memoryVisitedStore{}
+	}
+	var returnData []URLCollectionData
+
+	frontier := crawlFilter(seeds, visited, o.crawlMaxPages)
+	for depth := 0; len(frontier) > 0; depth++ {
+		logh.Map[appName].Printf(logh.Debug, "Crawl depth:%d, urls:%d", depth, len(frontier))
+		ucds := CollectURLs(frontier, timeout, http.MethodGet, threads, opts...)
+		returnData = append(returnData, ucds...)
+		if o.crawlMaxDepth >= 0 && depth >= o.crawlMaxDepth {
+			break
+		}
+
+		var links []string
+		for _, ucd := range ucds {
+			if ucd.Err != nil {
+				continue
+			}
+			base, err := url.Parse(ucd.URL)
+			if err != nil {
+				continue
+			}
+			for _, link := range extract(ucd) {
+				u, err := base.Parse(link)
+				if err != nil {
+					logh.Map[appName].Printf(logh.Debug, "Crawl error parsing link:%v", err)
+					continue
+				}
+				u.Fragment = ""
+				links = append(links, u.String())
+			}
+		}
+		remaining := 0
+		if o.crawlMaxPages > 0 {
+			remaining = o.crawlMaxPages - len(returnData)
+			if remaining <= 0 {
+				break
+			}
+		}
+		frontier = crawlFilter(links, visited, remaining)
+	}
+
+	return returnData
+}
+
+// crawlFilter - Return the URLs not already visited, marking them visited. At most max
+// URLs are returned; max <= 0 means no limit.
+func crawlFilter(urls []string, visited VisitedStore, max int) []string {
+	var out []string
+	for _, u := range urls {
+		if max > 0 && len(out) >= max {
+			break
+		}
+		if visited.Seen(u) {
+			continue
+		}
+		visited.Add(u)
+		out = append(out, u)
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package httph
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawl(t *testing.T) {
+	// Each page links to the root, itself, and its two children, forming a binary tree.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "/ %s %s/0 %s/1#fragment", r.URL.Path, strings.TrimSuffix(r.URL.Path, "/"),
+			strings.TrimSuffix(r.URL.Path, "/"))
+	}))
+	defer server.Close()
+
+	extract := func(ucd URLCollectionData) []string {
+		return strings.Fields(string(ucd.Bytes))
+	}
+	paths := func(ucds []URLCollectionData) []string {
+		var p []string
+		for _, ucd := range ucds {
+			if ucd.Err != nil {
+				t.Errorf("Crawl returned non-nil error: %v", ucd.Err)
+			}
+			p = append(p, strings.TrimPrefix(ucd.URL, server.URL))
+		}
+		sort.Strings(p)
+		return p
+	}
+
+	ucds := Crawl([]string{server.URL + "/"}, 1*time.Second, 2, extract, WithCrawlMaxDepth(2))
+	expected := "/ /0 /0/0 /0/1 /1 /1/0 /1/1"
+	if got := strings.Join(paths(ucds), " "); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	ucds = Crawl([]string{server.URL + "/"}, 1*time.Second, 2, extract, WithCrawlMaxPages(4))
+	if len(ucds) != 4 {
+		t.Errorf("Expected 4 results, got %d: %v", len(ucds), paths(ucds))
+	}
+}
+
+func TestCrawlVisitedStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("/a /b /c"))
+	}))
+	defer server.Close()
+
+	extract := func(ucd URLCollectionData) []string {
+		return strings.Fields(string(ucd.Bytes))
+	}
+	// Another crawler has already visited /b.
+	store := memoryVisitedStore{server.URL + "/b": true}
+	ucds := Crawl([]string{server.URL + "/"}, 1*time.Second, 2, extract, WithCrawlVisitedStore(store))
+	if len(ucds) != 3 {
+		t.Errorf("Expected 3 results, got %d", len(ucds))
+	}
+	for _, ucd := range ucds {
+		if ucd.URL == server.URL+"/b" {
+			t.Errorf("Visited URL was fetched")
+		}
+	}
+	if len(store) != 4 {
+		t.Errorf("Expected 4 URLs in store, got %d", len(store))
+	}
+}
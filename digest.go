@@ -0,0 +1,117 @@
+package httph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrContentDigest is returned when the response Content-Digest is missing, has no supported
+	// algorithm, or does not match the body; see WithVerifyContentDigest.
+	ErrContentDigest = errors.New("content digest verification failed")
+)
+
+// digestAlgorithms are the supported RFC 9530 digest algorithms.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// WithContentDigest - Send an RFC 9530 Content-Digest header, using sha-256, with MethodPost and
+// MethodPut request bodies supplied by WithBody. The body is read once to compute the digest and
+// again to send it.
+func WithContentDigest() Option {
+	return func(o *options) {
+		o.contentDigest = true
+	}
+}
+
+// WithVerifyContentDigest - Verify the response body against the RFC 9530 Content-Digest header.
+// Every supported algorithm (sha-256, sha-512) in the header must match, and at least one must
+// be present, otherwise ErrContentDigest is returned. The digest covers the body as sent, so
+// transparent decompression is disabled. MethodHead responses are not verified. Files written by
+// CollectURLToFile, CollectURLsToDir, and ResumableDownload are verified once written; a
+// ResumableDownload partial response is verified against the digest of the part received.
+// CollectURLSSE returns ErrContentDigest, as events are handled before the body is complete.
+func WithVerifyContentDigest() Option {
+	return func(o *options) {
+		o.verifyContentDigest = true
+	}
+}
+
+// contentDigest - Return the Content-Digest header value for the body returned by getBody.
+func contentDigest(getBody func() (io.ReadCloser, error)) (string, error) {
+	body, err := getBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":", nil
+}
+
+// digestVerifier - An io.Writer that computes the digests of the body written to it, for
+// comparison with the expected digests.
+type digestVerifier struct {
+	expected map[string][]byte
+	hashes   map[string]hash.Hash
+}
+
+// newDigestVerifier - Parse the response Content-Digest header, a structured field dictionary
+// such as: sha-256=:base64:, sha-512=:base64:
+func newDigestVerifier(resp *http.Response) (*digestVerifier, error) {
+	header := resp.Header.Get("Content-Digest")
+	if header == "" {
+		return nil, fmt.Errorf("%w: no Content-Digest header", ErrContentDigest)
+	}
+	dv := &digestVerifier{expected: map[string][]byte{}, hashes: map[string]hash.Hash{}}
+	for _, member := range strings.Split(header, ",") {
+		alg, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+		alg = strings.ToLower(alg)
+		newHash, ok := digestAlgorithms[alg]
+		if !ok {
+			continue
+		}
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("%w: invalid %s value %q", ErrContentDigest, alg, value)
+		}
+		digest, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s value %q", ErrContentDigest, alg, value)
+		}
+		dv.expected[alg] = digest
+		dv.hashes[alg] = newHash()
+	}
+	if len(dv.hashes) == 0 {
+		return nil, fmt.Errorf("%w: no supported algorithm in %q", ErrContentDigest, header)
+	}
+	return dv, nil
+}
+
+func (dv *digestVerifier) Write(p []byte) (int, error) {
+	for _, h := range dv.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify - Compare the digests of the body written to the expected digests.
+func (dv *digestVerifier) verify() error {
+	for alg, h := range dv.hashes {
+		if !bytes.Equal(h.Sum(nil), dv.expected[alg]) {
+			return fmt.Errorf("%w: %s mismatch", ErrContentDigest, alg)
+		}
+	}
+	return nil
+}
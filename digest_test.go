@@ -0,0 +1,102 @@
+package httph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLContentDigest(t *testing.T) {
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Digest") != digest(b) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/bad":
+			w.Header().Set("Content-Digest", digest([]byte("other")))
+		case "/unsupported":
+			w.Header().Set("Content-Digest", "md5=:AAAA:")
+		case "/none":
+		default:
+			w.Header().Set("Content-Digest", "unknown=:AAAA:, "+digest(b))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	returnString := `{"value":"test CollectURL content digest"}`
+	getBody := func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(returnString)), nil
+	}
+	opts := []Option{WithBody(getBody, -1), WithContentDigest(), WithVerifyContentDigest()}
+	value, response, err := CollectURL(server.URL, 1*time.Second, http.MethodPost, opts...)
+	if err != nil || response.StatusCode != http.StatusOK || string(value) != returnString {
+		t.Errorf("Expected verified %s, got %s, error: %v", returnString, value, err)
+	}
+
+	for _, path := range []string{"/bad", "/unsupported", "/none"} {
+		_, _, err = CollectURL(server.URL+path, 1*time.Second, http.MethodPost, opts...)
+		if !errors.Is(err, ErrContentDigest) {
+			t.Errorf("path %s expected ErrContentDigest, got %v", path, err)
+		}
+	}
+}
+
+func TestCollectURLToFileContentDigest(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256(content)
+		if r.URL.Path == "/bad" {
+			sum = sha256.Sum256([]byte("other"))
+		}
+		w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	n, _, err := CollectURLToFile(server.URL, 1*time.Second, filepath.Join(dir, "good"), false,
+		WithVerifyContentDigest())
+	if err != nil || n != int64(len(content)) {
+		t.Errorf("Expected verified %d bytes, got %d, error: %v", len(content), n, err)
+	}
+	_, _, err = CollectURLToFile(server.URL+"/bad", 1*time.Second, filepath.Join(dir, "bad"), false,
+		WithVerifyContentDigest())
+	if !errors.Is(err, ErrContentDigest) {
+		t.Errorf("Expected ErrContentDigest, got %v", err)
+	}
+
+	dest := filepath.Join(dir, "resumed")
+	_, err = ResumableDownload(server.URL+"/bad", dest, 1*time.Second, WithVerifyContentDigest())
+	if !errors.Is(err, ErrContentDigest) {
+		t.Errorf("Expected ErrContentDigest, got %v", err)
+	}
+	if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected partial file removed, got %v", err)
+	}
+	n, err = ResumableDownload(server.URL, dest, 1*time.Second, WithVerifyContentDigest())
+	if err != nil || n != int64(len(content)) {
+		t.Errorf("Expected verified %d bytes, got %d, error: %v", len(content), n, err)
+	}
+
+	err = CollectURLSSE(context.Background(), server.URL, func(string) error { return nil }, WithVerifyContentDigest())
+	if !errors.Is(err, ErrContentDigest) {
+		t.Errorf("Expected ErrContentDigest, got %v", err)
+	}
+}
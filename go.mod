@@ -1,5 +1,5 @@
 module github.com/paulfdunn/httph
 
-go 1.19
+go 1.20
 
 require github.com/paulfdunn/logh v1.0.0
@@ -0,0 +1,48 @@
+package httph
+
+import (
+	"math"
+	"math/bits"
+)
+
+// sizeHistogram - A histogram of sizes, in power of two buckets: bucket 0 counts size 0, and
+// bucket i counts sizes in [2^(i-1), 2^i). Memory use is constant, and percentiles are
+// approximate, within a factor of two.
+type sizeHistogram struct {
+	buckets [65]int64
+	count   int64
+}
+
+func (h *sizeHistogram) add(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	h.buckets[bits.Len64(uint64(size))]++
+	h.count++
+}
+
+// percentile - Return the upper bound of the bucket containing percentile p (0 to 100) of the
+// sizes added, or 0 if none were added.
+func (h *sizeHistogram) percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	// The rank of the percentile, 1 to count.
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var n int64
+	for i, c := range h.buckets {
+		if n += c; n >= rank {
+			if i == 0 {
+				return 0
+			}
+			if i == 64 {
+				return math.MaxInt64
+			}
+			return int64(1)<<i - 1
+		}
+	}
+	return math.MaxInt64
+}
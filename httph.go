@@ -1,12 +1,18 @@
 package httph
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"net/url"
+	"os"
 	"sync"
 	"time"
 
@@ -20,97 +26,936 @@ type URLCollectionData struct {
 	Bytes    []byte
 	Response *http.Response
 	Err      error
+	// HeadFallback is true when a MethodHead request was retried as MethodGet; see
+	// WithHeadFallbackToGet.
+	HeadFallback bool
+	// BodyTail is the last bytes of the body; see WithBodyTail.
+	BodyTail []byte
+	// ConnEvents are the connection events of the request; see WithConnectionTrace.
+	ConnEvents []ConnEvent
+	// SniffedContentType is the content type detected from the body, which may differ from the
+	// Content-Type header; see WithContentSniffing.
+	SniffedContentType string
+	// StartedAt and CompletedAt are the times the request started and completed, including
+	// reading the body; CompletedAt.Sub(StartedAt) is the duration. Both are zero for URLs that
+	// were not requested, including URLs that failed validation or WithURLRewrite.
+	StartedAt   time.Time
+	CompletedAt time.Time
+	// CompressedBytes and DecompressedBytes are the number of body bytes received, and the number
+	// after decompression; they are equal when the response was not compressed. Only set for
+	// WithCompressionReport.
+	CompressedBytes   int64
+	DecompressedBytes int64
+	// FilePath and FileSize are the file the body was written to, and the number of bytes
+	// written, by functions that write bodies to files rather than Bytes.
+	FilePath string
+	FileSize int64
+}
+
+// ToResponse - Return a copy of ucd.Response, with a new Body that reads ucd.Bytes, for use by
+// code that consumes an http.Response. Each call returns a new Response and Body. The Header
+// and Trailer are copied. ContentLength is the length of ucd.Bytes, except for MethodHead, where
+// the original ContentLength is kept. Returns nil if ucd.Response is nil.
+func (ucd URLCollectionData) ToResponse() *http.Response {
+	if ucd.Response == nil {
+		return nil
+	}
+	resp := *ucd.Response
+	resp.Header = ucd.Response.Header.Clone()
+	resp.Trailer = ucd.Response.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(ucd.Bytes))
+	// A MethodHead response has no body; its ContentLength is that of the resource.
+	if ucd.Response.Request == nil || ucd.Response.Request.Method != http.MethodHead {
+		resp.ContentLength = int64(len(ucd.Bytes))
+	}
+	return &resp
+}
+
+// Option - Options are passed to the Collect functions to modify their default behavior.
+type Option func(*options)
+
+type options struct {
+	acceptInvalidHostnames map[string]bool
+	autoscaleMax           int
+	autoscaleMin           int
+	bodyContentLength      int64
+	bodyPipeline           []BodyTransform
+	bodyTailBytes          int
+	checkRedirect          func(req *http.Request, via []*http.Request) error
+	compressionReport      bool
+	connectionTrace        bool
+	contentSniffing        bool
+	contentDigest          bool
+	crawlMaxDepth          int
+	crawlMaxPages          int
+	crawlVisited           VisitedStore
+	debugBodiesMaxBytes    int
+	// debugBodiesPrintf logs at Debug level.
+	debugBodiesPrintf func(format string, v ...interface{})
+	errorSampler      *errorSampler
+	// expectedContentLength < 0 disables the check.
+	expectedContentLength int64
+	firstByteTimeout      time.Duration
+	getBody               func() (io.ReadCloser, error)
+	// header is added to each request; it is set internally, such as Range for CollectURLRange.
+	header http.Header
+	// headFallbackMaxBytes < 0 disables HEAD to GET fallback.
+	headFallbackMaxBytes   int64
+	headerAllowlist        map[string]bool
+	idleConnReaperInterval time.Duration
+	idleConnTimeout        time.Duration
+	keyLogWriter           io.Writer
+	maxBodyReadDuration    time.Duration
+	maxBodySize            int64
+	maxBufferedResults     int
+	maxURLLength           int
+	memoryBudget           *byteSemaphore
+	onStatus               func(url string, resp *http.Response) bool
+	// readBuffer is the buffer bodies are read into; it is set internally by CollectURLInto.
+	readBuffer           []byte
+	readDeadlinePerChunk time.Duration
+	rejectEmptyBody      bool
+	requestTrailer       func() http.Header
+	requestTrailerKeys   []string
+	retryAfterCap        time.Duration
+	rootCAs              *x509.CertPool
+	serverNames          map[string]string
+	signer               Signer
+	timeoutJitter        float64
+	transport            *http.Transport
+	urlRewrite           func(urlIn string) (string, error)
+	verifyContentDigest  bool
+	verifyTLS            bool
 }
 
 const (
 	appName = "quant"
 )
 
+var (
+	// ErrBodyAborted is returned when the WithOnStatus callback returned false, and the body
+	// was not read.
+	ErrBodyAborted = errors.New("body read aborted by status callback")
+	// ErrContentLengthHeader is returned when the response Content-Length header does not match
+	// the length specified with WithExpectedContentLength.
+	ErrContentLengthHeader = errors.New("content-length header does not match expected length")
+	// ErrContentLengthRead is returned when the number of body bytes read does not match
+	// the length specified with WithExpectedContentLength.
+	ErrContentLengthRead = errors.New("bytes read does not match expected length")
+	// ErrEmptyBody is returned when WithRejectEmptyBody is set and a successful response has
+	// no body.
+	ErrEmptyBody = errors.New("empty body")
+	// ErrMaxBodySize is returned when a body is larger than allowed by WithMaxBodySize.
+	ErrMaxBodySize = errors.New("body exceeds max size")
+	// ErrMaxBufferedResults is returned, for every URL, when CollectURLs is called with more
+	// URLs than allowed by WithMaxBufferedResults. No requests are made.
+	ErrMaxBufferedResults = errors.New("number of urls exceeds max buffered results")
+)
+
+// WithBodyTail - Retain the last size bytes of each response body in URLCollectionData.BodyTail.
+// The tail is kept even when reading the body fails part way, providing context for
+// diagnosing failed responses. size <= 0 disables (default).
+func WithBodyTail(size int) Option {
+	return func(o *options) {
+		o.bodyTailBytes = size
+	}
+}
+
+// WithBody - Supply the request body for MethodPost and MethodPut requests. getBody is called
+// for each send of the request and must return a new reader positioned at the start of the body;
+// it is also set as http.Request.GetBody, which allows net/http to re-send the body when a
+// request is retried or follows a 307/308 redirect. Without it a consumed, non-seekable body
+// could not be sent again. contentLength is the length of the body, and is sent as the
+// Content-Length header; use -1 when the length is not known, and the body is sent chunked.
+func WithBody(getBody func() (io.ReadCloser, error), contentLength int64) Option {
+	return func(o *options) {
+		o.bodyContentLength = contentLength
+		o.getBody = getBody
+	}
+}
+
+// WithContentSniffing - Set URLCollectionData.SniffedContentType to the content type detected,
+// using http.DetectContentType, from the first 512 bytes of each non-empty body, after any
+// decompression and WithBodyPipeline transforms.
+func WithContentSniffing() Option {
+	return func(o *options) {
+		o.contentSniffing = true
+	}
+}
+
+// WithDebugBodies - UNSAFE FOR PRODUCTION: bodies may contain secrets (tokens, cookies,
+// personal data) which will be written to the log. Logs, at Debug level, a hex dump of up
+// to maxBytes of each request body supplied by WithBody, and of each response body. maxBytes
+// <= 0 disables body logging.
+func WithDebugBodies(maxBytes int) Option {
+	return func(o *options) {
+		o.debugBodiesMaxBytes = maxBytes
+		o.debugBodiesPrintf = func(format string, v ...interface{}) {
+			logh.Map[appName].Printf(logh.Debug, format, v...)
+		}
+	}
+}
+
+// WithExpectedContentLength - Verify the response body is length bytes. If the response has a
+// Content-Length header that does not match, the body is not read and ErrContentLengthHeader is
+// returned. If the number of body bytes read does not match, ErrContentLengthRead is returned;
+// for MethodHead only the header is checked.
+// When a response is transparently decompressed the header is not available, and length is
+// compared to the decompressed bytes read.
+func WithExpectedContentLength(length int64) Option {
+	return func(o *options) {
+		o.expectedContentLength = length
+	}
+}
+
+// WithHeadFallbackToGet - Some servers do not implement MethodHead. When a MethodHead request
+// returns StatusMethodNotAllowed or StatusNotImplemented, the request is retried as MethodGet
+// and at most maxBytes of the body are read. URLCollectionData.HeadFallback is set when
+// the fallback occurred.
+func WithHeadFallbackToGet(maxBytes int64) Option {
+	return func(o *options) {
+		o.headFallbackMaxBytes = maxBytes
+	}
+}
+
+// WithIdleConnTimeout - By default every request is sent with "Connection: close" and
+// connections are not reused. Setting timeout > 0 enables keep-alive: the requests of a
+// CollectURLs batch share a transport and reuse connections, and idle connections are closed
+// by net/http after timeout (http.Transport.IdleConnTimeout). All idle connections are closed
+// when the batch is done, so file descriptor usage is bounded by the number of threads.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleConnTimeout = timeout
+	}
+}
+
+// WithIdleConnReaper - While a CollectURLs batch is running, close idle connections every
+// interval, in addition to the reaping done per WithIdleConnTimeout. This is only useful when
+// keep-alive is enabled with WithIdleConnTimeout.
+func WithIdleConnReaper(interval time.Duration) Option {
+	return func(o *options) {
+		o.idleConnReaperInterval = interval
+	}
+}
+
+// WithKeyLogWriter - TLS master secrets are written to w in NSS key log format, allowing
+// external programs such as Wireshark to decrypt captured TLS traffic (SSLKEYLOGFILE).
+// This compromises the security of the connections and should only be used for debugging.
+func WithKeyLogWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.keyLogWriter = w
+	}
+}
+
+// WithMaxBodySize - Stop reading a body, and return ErrMaxBodySize, once more than max bytes
+// have been read. The limit applies to the body after decompression, by the transport or by
+// WithBodyPipeline, so a small compressed body that decompresses to a huge size (a gzip bomb) is
+// stopped after max bytes. The bytes up to max are returned. max <= 0 disables (default).
+func WithMaxBodySize(max int64) Option {
+	return func(o *options) {
+		o.maxBodySize = max
+	}
+}
+
+// WithMaxBufferedResults - CollectURLs returns all results, including bodies, in a single
+// slice. To prevent an unexpectedly large input from exhausting memory, CollectURLs will make
+// no requests and return ErrMaxBufferedResults for every URL if len(urls) exceeds max.
+// max <= 0 means no limit (default).
+func WithMaxBufferedResults(max int) Option {
+	return func(o *options) {
+		o.maxBufferedResults = max
+	}
+}
+
+// WithOnStatus - Call onStatus as soon as the status and headers of each response are received,
+// before the body is read. If onStatus returns false, the body is not read, the connection is
+// closed, and ErrBodyAborted is returned. onStatus must not read resp.Body, and is called
+// concurrently by CollectURLs.
+func WithOnStatus(onStatus func(url string, resp *http.Response) bool) Option {
+	return func(o *options) {
+		o.onStatus = onStatus
+	}
+}
+
+// WithRejectEmptyBody - Return ErrEmptyBody when a successful (2xx) response to a MethodGet
+// request has no body, such as a proxy returning StatusOK with no content. StatusNoContent and
+// StatusResetContent responses are not rejected, as they never have a body.
+func WithRejectEmptyBody() Option {
+	return func(o *options) {
+		o.rejectEmptyBody = true
+	}
+}
+
+// WithTransport - Use a clone of tr for requests, rather than the default transport
+// (which skips TLS verification and uses timeout for dialing). tr is cloned before any option
+// driven modifications are applied, so tr itself is never modified and can safely be shared.
+func WithTransport(tr *http.Transport) Option {
+	return func(o *options) {
+		o.transport = tr
+	}
+}
+
+// newOptions - Apply opts, in order, to the default options.
+func newOptions(opts []Option) *options {
+	o := &options{crawlMaxDepth: -1, expectedContentLength: -1, headFallbackMaxBytes: -1,
+		maxURLLength: DefaultMaxURLLength}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // CollectURL - Pass in a URL, request timeout, HTTP method to use, and get back
-// the body of the request. HTTP method MUST be one of: [MethodGet, MethodHead]
-func CollectURL(urlIn string, timeout time.Duration, method string) ([]byte, *http.Response, error) {
+// the body of the request. HTTP method MUST be one of: [MethodGet, MethodHead, MethodPost, MethodPut];
+// use WithBody to supply a body for MethodPost and MethodPut.
+func CollectURL(urlIn string, timeout time.Duration, method string, opts ...Option) ([]byte, *http.Response, error) {
+	o := newOptions(opts)
+	client := newClient(timeout, false, o)
+	// The client is not reused, so idle connections are closed.
+	defer client.CloseIdleConnections()
+	ucd := collectURL(context.Background(), client, urlIn, method, o)
+	return ucd.Bytes, ucd.Response, ucd.Err
+}
+
+// collectURL - Implementation of CollectURL; ctx allows the caller to cancel the request.
+func collectURL(ctx context.Context, client *http.Client, urlIn string, method string, o *options) (ucd URLCollectionData) {
+	ucd.URL = urlIn
+	defer func() {
+		if !ucd.StartedAt.IsZero() {
+			ucd.CompletedAt = time.Now()
+		}
+	}()
+	if o.timeoutJitter > 0 && client.Timeout > 0 {
+		// A copy of the client shares its transport, so only the timeout differs.
+		jittered := *client
+		jittered.Timeout = jitter(client.Timeout, o.timeoutJitter)
+		client = &jittered
+	}
+	if o.connectionTrace {
+		ct := &connTracer{}
+		ctx = ct.withClientTrace(ctx)
+		defer func() { ucd.ConnEvents = ct.Events() }()
+	}
+	var report *compressionReportBody
+	if o.compressionReport {
+		ctx = context.WithValue(ctx, compressionReportKey{}, &report)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := newRequest(ctx, urlIn, method, o)
+	if err != nil {
+		ucd.Err = err
+		return ucd
+	}
+	ucd.StartedAt = time.Now()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Warning level, as the IP/host may be invalid, host down, etc.
+		o.logClientError("CollectURL", urlIn, err)
+		ucd.Bytes, ucd.Response, ucd.Err = []byte{}, resp, err
+		return ucd
+	}
+	var bodyReader io.Reader = resp.Body
+	if method == http.MethodHead && o.headFallbackMaxBytes >= 0 &&
+		(resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		logh.Map[appName].Printf(logh.Debug, "CollectURL HEAD status:%d, falling back to GET url:%s", resp.StatusCode, urlIn)
+		if req, err = newRequest(ctx, urlIn, http.MethodGet, o); err != nil {
+			ucd.Err = err
+			return ucd
+		}
+		ucd.HeadFallback = true
+		if resp, err = client.Do(req); err != nil {
+			o.logClientError("CollectURL", urlIn, err)
+			ucd.Bytes, ucd.Response, ucd.Err = []byte{}, resp, err
+			return ucd
+		}
+		bodyReader = io.LimitReader(resp.Body, o.headFallbackMaxBytes)
+	}
+	bodyReader, stopTimer := newTimedBodyReader(bodyReader, cancel, o)
+	defer stopTimer()
+	defer resp.Body.Close()
+	ucd.Response = resp
+	if o.onStatus != nil && !o.onStatus(urlIn, resp) {
+		logh.Map[appName].Printf(logh.Debug, "CollectURL url:%s, status:%d, body aborted", urlIn, resp.StatusCode)
+		ucd.Bytes, ucd.Err = []byte{}, ErrBodyAborted
+		return ucd
+	}
+	if err := o.checkContentLengthHeader(resp); err != nil {
+		ucd.Bytes, ucd.Err = []byte{}, err
+		return ucd
+	}
+	if o.memoryBudget != nil {
+		n, err := o.memoryBudget.acquire(ctx, resp.ContentLength)
+		if tbr, ok := bodyReader.(*timedBodyReader); ok && err != nil {
+			// Report a first byte timeout that expired while waiting, rather than the cancel.
+			if expired, ok := tbr.expired.Load().(error); ok {
+				err = expired
+			}
+		}
+		if err != nil {
+			ucd.Bytes, ucd.Err = []byte{}, err
+			return ucd
+		}
+		defer o.memoryBudget.release(n)
+	}
+	var digest *digestVerifier
+	if o.verifyContentDigest && method != http.MethodHead {
+		if digest, err = newDigestVerifier(resp); err != nil {
+			logh.Map[appName].Printf(logh.Warning, "CollectURL url:%s, %v", urlIn, err)
+			ucd.Bytes, ucd.Err = []byte{}, err
+			return ucd
+		}
+		bodyReader = io.TeeReader(bodyReader, digest)
+	}
+	raw := &countingReader{r: bodyReader}
+	bodyReader = raw
+	if len(o.bodyPipeline) > 0 {
+		if bodyReader, err = applyBodyPipeline(o.bodyPipeline, resp, bodyReader); err != nil {
+			logh.Map[appName].Printf(logh.Warning, "CollectURL body pipeline error:%v", err)
+			ucd.Bytes, ucd.Err = []byte{}, err
+			return ucd
+		}
+	}
+	bodyReader = o.limitBody(bodyReader)
+	var tail *ringBuffer
+	if o.bodyTailBytes > 0 {
+		tail = newRingBuffer(o.bodyTailBytes)
+		bodyReader = io.TeeReader(bodyReader, tail)
+	}
+	var body []byte
+	if o.readBuffer != nil {
+		body, err = readAllInto(o.readBuffer, bodyReader)
+	} else {
+		body, err = ioutil.ReadAll(bodyReader)
+	}
+	resp.Body.Close()
+	o.debugBody("response", urlIn, int64(len(body)), body)
+	if err == nil && method != http.MethodHead {
+		err = o.checkContentLengthRead(raw.n)
+	}
+	if err == nil && method == http.MethodGet {
+		err = o.checkEmptyBody(resp, raw.n)
+	}
+	if err == nil && digest != nil {
+		if err = digest.verify(); err != nil {
+			logh.Map[appName].Printf(logh.Warning, "CollectURL url:%s, %v", urlIn, err)
+		}
+	}
+	if tail != nil {
+		ucd.BodyTail = tail.Bytes()
+	}
+	if o.contentSniffing && len(body) > 0 {
+		ucd.SniffedContentType = http.DetectContentType(body)
+	}
+	if report != nil {
+		ucd.CompressedBytes, ucd.DecompressedBytes = report.compressed.n, report.n
+	}
+
+	ucd.Bytes, ucd.Err = body, err
+	return ucd
+}
+
+// CollectURLToFile - Pass in a URL, request timeout, and a file path, and the body of
+// a GET request is streamed to the file, rather than buffered in memory.
+// decompress controls whether transfer level compression (Content-Encoding) is removed
+// before writing. When false the body is written exactly as sent by the server, so a .gz
+// file is stored as a .gz file even if the server labeled it Content-Encoding: gzip.
+// When true gzip encoding is requested and any Content-Encoding: gzip is decoded on the fly.
+// The number of bytes written to the file is returned.
+func CollectURLToFile(urlIn string, timeout time.Duration, filePath string, decompress bool, opts ...Option) (int64, *http.Response, error) {
+	o := newOptions(opts)
+	client := newClient(timeout, !decompress, o)
+	// The client is not reused, so idle connections are closed.
+	defer client.CloseIdleConnections()
+	return collectURLToFile(context.Background(), client, urlIn, filePath, nil, o)
+}
+
+// collectURLToFile - Implementation of CollectURLToFile.
+func collectURLToFile(ctx context.Context, client *http.Client, urlIn string, filePath string,
+	startedAt *time.Time, o *options) (int64, *http.Response, error) {
+	req, err := newRequest(ctx, urlIn, http.MethodGet, o)
+	if err != nil {
+		return 0, nil, err
+	}
+	if startedAt != nil {
+		*startedAt = time.Now()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		o.logClientError("CollectURLToFile", urlIn, err)
+		return 0, resp, err
+	}
+	defer resp.Body.Close()
+	if err := o.checkContentLengthHeader(resp); err != nil {
+		return 0, resp, err
+	}
+
+	var digest *digestVerifier
+	if o.verifyContentDigest {
+		if digest, err = newDigestVerifier(resp); err != nil {
+			logh.Map[appName].Printf(logh.Warning, "CollectURLToFile url:%s, %v", urlIn, err)
+			return 0, resp, err
+		}
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		logh.Map[appName].Printf(logh.Error, "CollectURLToFile error creating file:%v", err)
+		return 0, resp, err
+	}
+	writers := []io.Writer{f}
+	var debug *prefixBuffer
+	if o.debugBodiesMaxBytes > 0 {
+		debug = &prefixBuffer{max: o.debugBodiesMaxBytes}
+		writers = append(writers, debug)
+	}
+	if digest != nil {
+		writers = append(writers, digest)
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), o.limitBody(resp.Body))
+	if debug != nil {
+		o.debugBody("response", urlIn, n, debug.buf)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = o.checkContentLengthRead(n)
+	}
+	if err == nil {
+		err = o.checkEmptyBody(resp, n)
+	}
+	if err == nil && digest != nil {
+		err = digest.verify()
+	}
+
+	return n, resp, err
+}
+
+// newRequest - Validate the URL and method and build the request. HTTP method MUST be
+// one of: [MethodGet, MethodHead, MethodPost, MethodPut]
+func newRequest(ctx context.Context, urlIn string, method string, o *options) (*http.Request, error) {
 	var req *http.Request
-	u, err := url.Parse(urlIn)
+	u, err := requestURL(urlIn, o)
 	if err != nil {
-		logh.Map[appName].Printf(logh.Error, "CollectURL error parsing urlIn:%v", err)
-		return []byte{}, nil, err
+		logh.Map[appName].Printf(logh.Error, "CollectURL error with urlIn:%v", err)
+		return nil, err
 	}
 
 	var reqErr error
 	switch method {
 	case http.MethodGet:
-		req, reqErr = http.NewRequest(http.MethodGet, u.String(), nil)
+		req, reqErr = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	case http.MethodHead:
-		req, reqErr = http.NewRequest(http.MethodHead, u.String(), nil)
+		req, reqErr = http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	case http.MethodPost, http.MethodPut:
+		var body io.ReadCloser
+		if o.getBody != nil {
+			if body, reqErr = o.getBody(); reqErr != nil {
+				break
+			}
+		}
+		req, reqErr = http.NewRequestWithContext(ctx, method, u.String(), body)
+		if reqErr == nil && o.getBody != nil {
+			req.GetBody = o.getBody
+			// getBody returns an opaque reader, so net/http can not determine the length.
+			if o.bodyContentLength >= 0 {
+				req.ContentLength = o.bodyContentLength
+			}
+			if o.bodyContentLength == 0 {
+				body.Close()
+				req.Body = http.NoBody
+			}
+			reqErr = o.debugRequestBody(urlIn)
+			if reqErr == nil && o.contentDigest {
+				var digest string
+				if digest, reqErr = contentDigest(o.getBody); reqErr == nil {
+					req.Header.Set("Content-Digest", digest)
+				}
+			}
+		}
 	default:
 		err := fmt.Errorf("invalid method: %s", method)
 		logh.Map[appName].Printf(logh.Error, "%v", err)
-		return nil, nil, err
+		return nil, err
 	}
 
 	if reqErr != nil {
 		logh.Map[appName].Printf(logh.Error, "Error creating http.Request:%+v", reqErr)
-		return nil, nil, reqErr
-	}
-	req.Header.Set("Connection", "close")
-	req.Close = true
-
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		Dial: (&net.Dialer{
-			// This timeout is require in order to prevent "too many open file" errors.
-			Timeout:   timeout,
-			KeepAlive: timeout,
-		}).Dial}
-	client := http.Client{Timeout: timeout, Transport: tr}
-	resp, err := client.Do(req)
-	if err != nil {
-		// Warning level, as the IP/host may be invalid, host down, etc.
-		logh.Map[appName].Printf(logh.Warning, "CollectURL client error:%v", err)
-		return []byte{}, resp, err
+		return nil, reqErr
+	}
+	for k, v := range o.header {
+		req.Header[k] = v
+	}
+	if o.idleConnTimeout <= 0 {
+		req.Header.Set("Connection", "close")
+		req.Close = true
+	}
+
+	return req, nil
+}
+
+// newClient - Build the client used for a request. disableCompression is passed through to
+// http.Transport.DisableCompression.
+func newClient(timeout time.Duration, disableCompression bool, o *options) *http.Client {
+	var tr *http.Transport
+	if o.transport != nil {
+		// Clone so the caller's transport is not modified by the changes below.
+		tr = o.transport.Clone()
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+	} else {
+		tr = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: (&net.Dialer{
+				// This timeout is require in order to prevent "too many open file" errors.
+				Timeout:   timeout,
+				KeepAlive: timeout,
+			}).DialContext}
+	}
+	if disableCompression || o.verifyContentDigest {
+		tr.DisableCompression = true
+	}
+	if o.keyLogWriter != nil {
+		tr.TLSClientConfig.KeyLogWriter = o.keyLogWriter
+	}
+	if o.idleConnTimeout > 0 {
+		tr.IdleConnTimeout = o.idleConnTimeout
+	}
+	if o.readDeadlinePerChunk > 0 {
+		wrapDial(tr, func(c net.Conn) net.Conn {
+			// A new connection is dialed for a request, so it starts active.
+			return &deadlineConn{Conn: c, timeout: o.readDeadlinePerChunk, active: true}
+		})
+	}
+	if o.verifyTLS {
+		tr.TLSClientConfig.InsecureSkipVerify = false
+		if o.rootCAs != nil {
+			tr.TLSClientConfig.RootCAs = o.rootCAs
+		}
+	}
+	if o.serverNames != nil || o.verifyTLS {
+		setTLSDial(tr, o)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
 
-	return body, resp, err
+	var rt http.RoundTripper = tr
+	// trailerTransport must wrap the http.Transport directly; see trailerTransport.
+	if o.requestTrailer != nil {
+		rt = &trailerTransport{rt: rt, keys: o.requestTrailerKeys, values: o.requestTrailer}
+	}
+	if o.readDeadlinePerChunk > 0 {
+		rt = &deadlineTransport{rt: rt}
+	}
+	if o.compressionReport && !tr.DisableCompression {
+		tr.DisableCompression = true
+		rt = &compressionReportTransport{rt: rt}
+	}
+	if o.headerAllowlist != nil {
+		rt = &headerAllowlistTransport{rt: rt, allow: o.headerAllowlist}
+	}
+	// The allowlist is applied after signing, so only allowed headers are sent.
+	if o.signer != nil {
+		rt = &signerTransport{rt: rt, signer: o.signer}
+	}
+	client := &http.Client{Timeout: timeout, Transport: rt}
+	if o.checkRedirect != nil {
+		client.CheckRedirect = recoverCheckRedirect(o.checkRedirect)
+	}
+	return client
 }
 
 // CollectURLs - Pass in a slice of URLs, request timeout, HTTP method to use, and
 // get back a slice of URLCollectionData with results.
 // The URLs are processed in parallel using threads number of parallel requests.
-func CollectURLs(urls []string, timeout time.Duration, method string, threads int) []URLCollectionData {
+// All results, including bodies, are held in memory until returned; use WithMaxBufferedResults
+// to guard against very large inputs, or CollectURLToFile to keep bodies out of memory.
+func CollectURLs(urls []string, timeout time.Duration, method string, threads int, opts ...Option) []URLCollectionData {
+	return CollectURLsContext(context.Background(), urls, timeout, method, threads, opts...)
+}
+
+// CollectURLsContext - Same as CollectURLs, but the batch is bounded by ctx. When ctx is done,
+// in flight requests are cancelled and URLs that have not started are not requested; a result
+// is still returned for every URL, with Err satisfying errors.Is(Err, ctx.Err()) for the
+// cancelled and un-started URLs. Results collected before ctx was done are returned as normal.
+func CollectURLsContext(ctx context.Context, urls []string, timeout time.Duration, method string, threads int,
+	opts ...Option) []URLCollectionData {
+	o := newOptions(opts)
+	client := newClient(timeout, false, o)
+	return collectURLs(urls, threads, o, client, func(url string) URLCollectionData {
+		if err := ctx.Err(); err != nil {
+			return URLCollectionData{URL: url, Err: err}
+		}
+		return collectURL(ctx, client, url, method, o)
+	})
+}
+
+// AggregateErrors - Return errors.Join of the Err of each URLCollectionData, annotated with
+// its URL, or nil if there are no errors. The result supports errors.Is and errors.As.
+func AggregateErrors(ucds []URLCollectionData) error {
+	var errs []error
+	for _, ucd := range ucds {
+		if ucd.Err != nil {
+			errs = append(errs, fmt.Errorf("url %s: %w", ucd.URL, ucd.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reapIdleConnections - Call client.CloseIdleConnections every interval until done is closed.
+func reapIdleConnections(client *http.Client, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			client.CloseIdleConnections()
+		case <-done:
+			return
+		}
+	}
+}
+
+// collectURLs - Implementation of CollectURLs; collect is called by the workers for each URL.
+// client is shared by all workers, and its idle connections are closed when the batch is done.
+func collectURLs(urls []string, threads int, o *options, client *http.Client,
+	collect func(url string) URLCollectionData) []URLCollectionData {
+	if o.maxBufferedResults > 0 && len(urls) > o.maxBufferedResults {
+		logh.Map[appName].Printf(logh.Error, "CollectURLs %d urls exceeds max buffered results %d",
+			len(urls), o.maxBufferedResults)
+		returnData := make([]URLCollectionData, len(urls))
+		for i, url := range urls {
+			returnData[i] = URLCollectionData{URL: url, Err: ErrMaxBufferedResults}
+		}
+		return returnData
+	}
+
 	// Channel to feed work to the go routines
 	tasks := make(chan string, threads)
-	// Channel to return data from the workers.
-	workerOut := make(chan URLCollectionData, len(urls))
+	// Channel to return data from the workers. Results are drained as they arrive, so the
+	// buffer is sized to the number of workers, not the number of URLs.
+	workerOut := make(chan URLCollectionData, threads)
 	// Data to return to caller
 	var returnData []URLCollectionData
 
 	// Spawn threads number of workers
+	as := newAutoscaler(o, threads)
 	var wg sync.WaitGroup
 	for i := 0; i < threads; i++ {
 		wg.Add(1)
 		go func(sendResult chan URLCollectionData) {
 			for url := range tasks {
-				b, resp, e := CollectURL(url, timeout, method)
-				sendResult <- URLCollectionData{url, b, resp, e}
+				if as == nil {
+					sendResult <- collect(url)
+					continue
+				}
+				as.acquire()
+				r := collect(url)
+				as.release(r)
+				sendResult <- r
 			}
 			wg.Done()
 		}(workerOut)
 	}
 
-	for _, url := range urls {
-		tasks <- url
+	batchDone := make(chan struct{})
+	if o.idleConnReaperInterval > 0 {
+		go reapIdleConnections(client, o.idleConnReaperInterval, batchDone)
 	}
-	close(tasks)
 
-	wg.Wait()
-	// Workers are done, all data should have already been returned.
-	close(workerOut)
+	go func() {
+		for _, url := range urls {
+			tasks <- url
+		}
+		close(tasks)
+
+		wg.Wait()
+		// Workers are done, all data has been sent.
+		close(workerOut)
+		close(batchDone)
+		client.CloseIdleConnections()
+	}()
+
 	for r := range workerOut {
 		returnData = append(returnData, r)
 		logh.Map[appName].Printf(logh.Debug, "CollectURLs url:%v, error:%v", r.URL, r.Err)
 	}
+	if o.errorSampler != nil {
+		o.errorSampler.flush()
+	}
 
 	return returnData
 }
+
+// checkContentLengthHeader - Compare the Content-Length header, if present, to the expected length.
+func (o *options) checkContentLengthHeader(resp *http.Response) error {
+	if o.expectedContentLength < 0 || resp.ContentLength < 0 {
+		return nil
+	}
+	if resp.ContentLength != o.expectedContentLength {
+		err := fmt.Errorf("%w: expected %d, got %d", ErrContentLengthHeader, o.expectedContentLength, resp.ContentLength)
+		logh.Map[appName].Printf(logh.Warning, "%v", err)
+		return err
+	}
+	return nil
+}
+
+// checkContentLengthRead - Compare the number of body bytes read to the expected length.
+func (o *options) checkContentLengthRead(n int64) error {
+	if o.expectedContentLength < 0 || n == o.expectedContentLength {
+		return nil
+	}
+	err := fmt.Errorf("%w: expected %d, got %d", ErrContentLengthRead, o.expectedContentLength, n)
+	logh.Map[appName].Printf(logh.Warning, "%v", err)
+	return err
+}
+
+// checkEmptyBody - Return ErrEmptyBody for a successful response with no body, if enabled.
+func (o *options) checkEmptyBody(resp *http.Response, n int64) error {
+	if !o.rejectEmptyBody || n > 0 || resp.StatusCode < 200 || resp.StatusCode > 299 ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusResetContent {
+		return nil
+	}
+	err := fmt.Errorf("%w: status %d", ErrEmptyBody, resp.StatusCode)
+	logh.Map[appName].Printf(logh.Warning, "url:%s, %v", resp.Request.URL, err)
+	return err
+}
+
+// debugBody - Log a hex dump of up to debugBodiesMaxBytes of body, when enabled. kind is
+// "request" or "response", length is the length of the whole body, and body may be only the
+// start of it.
+func (o *options) debugBody(kind string, urlIn string, length int64, body []byte) {
+	if o.debugBodiesMaxBytes <= 0 {
+		return
+	}
+	n := len(body)
+	if n > o.debugBodiesMaxBytes {
+		n = o.debugBodiesMaxBytes
+	}
+	o.debugBodiesPrintf("%s body url:%s, length:%d, first %d bytes:\n%s",
+		kind, urlIn, length, n, hex.Dump(body[:n]))
+}
+
+// debugRequestBody - Log the request body supplied by WithBody, when enabled. getBody is called
+// for a reader of its own, so the body sent is not consumed.
+func (o *options) debugRequestBody(urlIn string) error {
+	if o.debugBodiesMaxBytes <= 0 || o.getBody == nil {
+		return nil
+	}
+	body, err := o.getBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	debug := &prefixBuffer{max: o.debugBodiesMaxBytes}
+	n, err := io.Copy(debug, body)
+	if err != nil {
+		return err
+	}
+	o.debugBody("request", urlIn, n, debug.buf)
+	return nil
+}
+
+// prefixBuffer - An io.Writer that retains only the first max bytes written to it.
+type prefixBuffer struct {
+	max int
+	buf []byte
+}
+
+func (pb *prefixBuffer) Write(p []byte) (int, error) {
+	if remaining := pb.max - len(pb.buf); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		pb.buf = append(pb.buf, p[:remaining]...)
+	}
+	return len(p), nil
+}
+
+// limitBody - Wrap r to enforce WithMaxBodySize; returns r if there is no limit.
+func (o *options) limitBody(r io.Reader) io.Reader {
+	if o.maxBodySize <= 0 {
+		return r
+	}
+	return &maxBodyReader{r: r, max: o.maxBodySize, remaining: o.maxBodySize}
+}
+
+// maxBodyReader - An io.Reader that returns ErrMaxBodySize when more than the limit would be read.
+type maxBodyReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func (mr *maxBodyReader) Read(p []byte) (int, error) {
+	if mr.remaining <= 0 {
+		// Read one byte to differentiate a body of exactly max bytes from a larger one.
+		var b [1]byte
+		n, err := mr.r.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrMaxBodySize, mr.max)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > mr.remaining {
+		p = p[:mr.remaining]
+	}
+	n, err := mr.r.Read(p)
+	mr.remaining -= int64(n)
+	return n, err
+}
+
+// countingReader - An io.Reader that counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// ringBuffer - An io.Writer that retains only the last size bytes written to it.
+type ringBuffer struct {
+	buf  []byte
+	pos  int
+	full bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, size)}
+}
+
+func (rb *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n == 0 {
+		return 0, nil
+	}
+	if n >= len(rb.buf) {
+		copy(rb.buf, p[len(p)-len(rb.buf):])
+		rb.pos, rb.full = 0, true
+		return n, nil
+	}
+	c := copy(rb.buf[rb.pos:], p)
+	if c < len(p) {
+		copy(rb.buf, p[c:])
+		rb.full = true
+	}
+	rb.pos = (rb.pos + len(p)) % len(rb.buf)
+	if rb.pos == 0 {
+		rb.full = true
+	}
+	return n, nil
+}
+
+// Bytes - Return a copy of the retained bytes, oldest first.
+func (rb *ringBuffer) Bytes() []byte {
+	if !rb.full {
+		return append([]byte{}, rb.buf[:rb.pos]...)
+	}
+	return append(append([]byte{}, rb.buf[rb.pos:]...), rb.buf[:rb.pos]...)
+}
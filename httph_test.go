@@ -1,8 +1,20 @@
 package httph
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -66,3 +78,630 @@ func TestCollectURLs(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectURLToFile(t *testing.T) {
+	returnString := `{"value":"test CollectURLToFile"}`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(returnString))
+	zw.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		w.Write(gz.Bytes())
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	rawPath := filepath.Join(dir, "raw.gz")
+	n, _, err := CollectURLToFile(server.URL, 1*time.Second, rawPath, false)
+	if err != nil {
+		t.Errorf("CollectURLToFile returned non-nil error: %v", err)
+		return
+	}
+	raw, _ := os.ReadFile(rawPath)
+	if n != int64(gz.Len()) || !bytes.Equal(raw, gz.Bytes()) {
+		t.Errorf("Expected raw gzip bytes to be written, got %d bytes", n)
+	}
+
+	decPath := filepath.Join(dir, "decompressed")
+	_, _, err = CollectURLToFile(server.URL, 1*time.Second, decPath, true)
+	if err != nil {
+		t.Errorf("CollectURLToFile returned non-nil error: %v", err)
+		return
+	}
+	dec, _ := os.ReadFile(decPath)
+	if string(dec) != returnString {
+		t.Errorf("Expected %s, got %s", returnString, dec)
+	}
+}
+
+func TestPrefixBuffer(t *testing.T) {
+	pb := &prefixBuffer{max: 5}
+	for _, p := range []string{"abc", "def", "ghi"} {
+		n, err := pb.Write([]byte(p))
+		if n != len(p) || err != nil {
+			t.Errorf("Write returned n:%d, err:%v", n, err)
+		}
+	}
+	if string(pb.buf) != "abcde" {
+		t.Errorf("Expected abcde, got %s", pb.buf)
+	}
+}
+
+func TestCollectURLDebugBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write(append(b, " back"...))
+	}))
+	defer server.Close()
+
+	var logs []string
+	capture := func(o *options) {
+		o.debugBodiesPrintf = func(format string, v ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, v...))
+		}
+	}
+	getBody := func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("hello world")), nil
+	}
+	_, _, err := CollectURL(server.URL, 1*time.Second, http.MethodPost, WithBody(getBody, 11),
+		WithDebugBodies(4), capture)
+	if err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+	}
+	_, _, err = CollectURLToFile(server.URL, 1*time.Second, filepath.Join(t.TempDir(), "file"), false,
+		WithDebugBodies(4), capture)
+	if err != nil {
+		t.Errorf("CollectURLToFile returned non-nil error: %v", err)
+	}
+	expected := []string{
+		"request body url:" + server.URL + ", length:11, first 4 bytes:\n" + hex.Dump([]byte("hell")),
+		"response body url:" + server.URL + ", length:16, first 4 bytes:\n" + hex.Dump([]byte("hell")),
+		"response body url:" + server.URL + ", length:5, first 4 bytes:\n" + hex.Dump([]byte(" bac")),
+	}
+	if strings.Join(logs, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected logs %q, got %q", expected, logs)
+	}
+}
+
+func TestCollectURLsMaxBufferedResults(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL, server.URL, server.URL}
+	ucds := CollectURLs(urls, 1*time.Second, http.MethodGet, 2, WithMaxBufferedResults(2))
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+		return
+	}
+	for _, ucd := range ucds {
+		if !errors.Is(ucd.Err, ErrMaxBufferedResults) {
+			t.Errorf("Expected ErrMaxBufferedResults, got %v", ucd.Err)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("Expected no requests, got %d", requests)
+	}
+
+	ucds = CollectURLs(urls, 1*time.Second, http.MethodGet, 2, WithMaxBufferedResults(3))
+	for _, ucd := range ucds {
+		if ucd.Err != nil {
+			t.Errorf("CollectURLs returned non-nil error: %v", ucd.Err)
+		}
+	}
+}
+
+func TestCollectURLKeyLogWriter(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var keyLog bytes.Buffer
+	_, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet, WithKeyLogWriter(&keyLog))
+	if err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+		return
+	}
+	if !strings.Contains(keyLog.String(), "CLIENT_") {
+		t.Errorf("Expected key log to contain secrets, got %q", keyLog.String())
+	}
+}
+
+func TestCollectURLBody(t *testing.T) {
+	returnString := `{"value":"test CollectURL body"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	// A 307 redirect requires the body be sent a second time; the reader is not seekable,
+	// so GetBody must be used.
+	var calls int32
+	getBody := func() (io.ReadCloser, error) {
+		atomic.AddInt32(&calls, 1)
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte(returnString))
+			pw.Close()
+		}()
+		return pr, nil
+	}
+	value, response, err := CollectURL(server.URL+"/redirect", 1*time.Second, http.MethodPost, WithBody(getBody, -1))
+	if err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+		return
+	}
+	if string(value) != returnString {
+		t.Errorf("Expected %s, got %s", returnString, value)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("incorrect status, expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Expected getBody to be called 2 times, got %d", calls)
+	}
+}
+
+func TestCollectURLBodyContentLength(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write([]byte(fmt.Sprintf("%d %v %s", r.ContentLength, r.TransferEncoding, b)))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		body          string
+		contentLength int64
+		expected      string
+	}{
+		{"hello", 5, "5 [] hello"},
+		{"hello", -1, "-1 [chunked] hello"},
+		{"", 0, "0 [] "},
+	}
+	for _, test := range tests {
+		getBody := func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(test.body)), nil
+		}
+		value, _, err := CollectURL(server.URL, 1*time.Second, http.MethodPut, WithBody(getBody, test.contentLength))
+		if err != nil || string(value) != test.expected {
+			t.Errorf("Expected %q, got %q, error: %v", test.expected, value, err)
+		}
+	}
+}
+
+func TestCollectURLExpectedContentLength(t *testing.T) {
+	returnString := `{"value":"test CollectURL content length"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing the body prevents a Content-Length header.
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(returnString))
+	}))
+	defer server.Close()
+
+	length := int64(len(returnString))
+	if _, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet, WithExpectedContentLength(length)); err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+	}
+	if _, _, err := CollectURL(server.URL, 1*time.Second, http.MethodHead, WithExpectedContentLength(length)); err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+	}
+
+	_, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet, WithExpectedContentLength(length+1))
+	if !errors.Is(err, ErrContentLengthHeader) {
+		t.Errorf("Expected ErrContentLengthHeader, got %v", err)
+	}
+
+	_, _, err = CollectURL(server.URL+"/chunked", 1*time.Second, http.MethodGet, WithExpectedContentLength(length+1))
+	if !errors.Is(err, ErrContentLengthRead) {
+		t.Errorf("Expected ErrContentLengthRead, got %v", err)
+	}
+}
+
+func TestCollectURLTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tr := server.Client().Transport.(*http.Transport)
+	tlsConfig := tr.TLSClientConfig
+	var keyLog bytes.Buffer
+	_, _, err := CollectURLToFile(server.URL, 1*time.Second, filepath.Join(t.TempDir(), "body"), false,
+		WithTransport(tr), WithKeyLogWriter(&keyLog))
+	if err != nil {
+		t.Errorf("CollectURLToFile returned non-nil error: %v", err)
+		return
+	}
+	if keyLog.Len() == 0 {
+		t.Errorf("Expected key log to be written")
+	}
+	if tr.DisableCompression || tr.TLSClientConfig != tlsConfig || tlsConfig.KeyLogWriter != nil {
+		t.Errorf("Caller's transport was modified")
+	}
+}
+
+func TestCollectURLsHeadFallbackToGet(t *testing.T) {
+	returnString := `{"value":"test CollectURLs head fallback"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(returnString))
+	}))
+	defer server.Close()
+
+	ucds := CollectURLs([]string{server.URL}, 1*time.Second, http.MethodHead, 1)
+	if ucds[0].Response.StatusCode != http.StatusMethodNotAllowed || ucds[0].HeadFallback {
+		t.Errorf("Expected status %d without fallback, got %d, fallback %t", http.StatusMethodNotAllowed,
+			ucds[0].Response.StatusCode, ucds[0].HeadFallback)
+	}
+
+	ucds = CollectURLs([]string{server.URL}, 1*time.Second, http.MethodHead, 1, WithHeadFallbackToGet(4))
+	if ucds[0].Err != nil {
+		t.Errorf("CollectURLs returned non-nil error: %v", ucds[0].Err)
+		return
+	}
+	if ucds[0].Response.StatusCode != http.StatusOK || !ucds[0].HeadFallback {
+		t.Errorf("Expected status %d with fallback, got %d, fallback %t", http.StatusOK,
+			ucds[0].Response.StatusCode, ucds[0].HeadFallback)
+	}
+	if string(ucds[0].Bytes) != returnString[:4] {
+		t.Errorf("Expected %s, got %s", returnString[:4], ucds[0].Bytes)
+	}
+}
+
+func TestCollectURLsIdleConnTimeout(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(c net.Conn, cs http.ConnState) {
+		if cs == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	urls := []string{server.URL, server.URL, server.URL, server.URL}
+	CollectURLs(urls, 1*time.Second, http.MethodGet, 1)
+	if c := atomic.SwapInt32(&conns, 0); c != int32(len(urls)) {
+		t.Errorf("Expected %d connections without keep-alive, got %d", len(urls), c)
+	}
+
+	ucds := CollectURLs(urls, 1*time.Second, http.MethodGet, 1,
+		WithIdleConnTimeout(time.Second), WithIdleConnReaper(time.Hour))
+	for _, ucd := range ucds {
+		if ucd.Err != nil {
+			t.Errorf("CollectURLs returned non-nil error: %v", ucd.Err)
+		}
+	}
+	if c := atomic.LoadInt32(&conns); c != 1 {
+		t.Errorf("Expected 1 connection with keep-alive, got %d", c)
+	}
+}
+
+func TestCollectURLsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	urls := []string{server.URL + "/0", server.URL + "/1", server.URL + "/slow", server.URL + "/3", server.URL + "/4"}
+	ucds := CollectURLsContext(ctx, urls, 5*time.Second, http.MethodGet, 1)
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+		return
+	}
+	for i, ucd := range ucds {
+		// A single thread returns results in order.
+		if ucd.URL != urls[i] {
+			t.Errorf("Expected url %s, got %s", urls[i], ucd.URL)
+		}
+		if i < 2 {
+			if ucd.Err != nil || ucd.Response.StatusCode != http.StatusOK {
+				t.Errorf("Expected completed result, got %+v", ucd)
+			}
+			continue
+		}
+		if !errors.Is(ucd.Err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", ucd.Err)
+		}
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	rb := newRingBuffer(5)
+	expected := []string{"", "ab", "abcde", "cdefg", "fghij", "mnopq"}
+	for i, p := range []string{"", "ab", "cde", "fg", "hij", "klmnopq"} {
+		rb.Write([]byte(p))
+		if string(rb.Bytes()) != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], rb.Bytes())
+		}
+	}
+}
+
+func TestCollectURLsBodyTail(t *testing.T) {
+	returnString := `{"value":"test CollectURLs body tail"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(returnString))
+	}))
+	defer server.Close()
+
+	ucds := CollectURLs([]string{server.URL}, 1*time.Second, http.MethodGet, 1, WithBodyTail(8))
+	if ucds[0].Err != nil {
+		t.Errorf("CollectURLs returned non-nil error: %v", ucds[0].Err)
+		return
+	}
+	if tail := returnString[len(returnString)-8:]; string(ucds[0].BodyTail) != tail {
+		t.Errorf("Expected %s, got %s", tail, ucds[0].BodyTail)
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	if err := AggregateErrors([]URLCollectionData{{URL: "a"}, {URL: "b"}}); err != nil {
+		t.Errorf("Expected nil error, got %v", err)
+	}
+
+	ucds := []URLCollectionData{{URL: "a", Err: ErrContentLengthRead}, {URL: "b"}, {URL: "c", Err: ErrRangeResponse}}
+	err := AggregateErrors(ucds)
+	if !errors.Is(err, ErrContentLengthRead) || !errors.Is(err, ErrRangeResponse) {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "url a:") || !strings.Contains(err.Error(), "url c:") {
+		t.Errorf("Expected errors annotated with URL, got %v", err)
+	}
+}
+
+func TestURLCollectionDataToResponse(t *testing.T) {
+	returnString := `{"value":"test ToResponse"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(returnString))
+	}))
+	defer server.Close()
+
+	ucds := CollectURLs([]string{server.URL}, 1*time.Second, http.MethodGet, 1)
+	for i := 0; i < 2; i++ {
+		resp := ucds[0].ToResponse()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil || string(b) != returnString {
+			t.Errorf("Expected %s, got %s, error: %v", returnString, b, err)
+		}
+		if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Content-Type") != "application/json" ||
+			resp.ContentLength != int64(len(returnString)) {
+			t.Errorf("Response does not match, got %+v", resp)
+		}
+		resp.Header.Set("Content-Type", "modified")
+	}
+
+	ucds = CollectURLs([]string{server.URL}, 1*time.Second, http.MethodHead, 1)
+	resp := ucds[0].ToResponse()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil || len(b) != 0 || resp.ContentLength != int64(len(returnString)) {
+		t.Errorf("Expected empty body with ContentLength %d, got %d, body: %s, error: %v",
+			len(returnString), resp.ContentLength, b, err)
+	}
+
+	if (URLCollectionData{URL: server.URL}).ToResponse() != nil {
+		t.Errorf("Expected nil Response")
+	}
+}
+
+func TestCollectURLRejectEmptyBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nocontent":
+			w.WriteHeader(http.StatusNoContent)
+		case "/body":
+			w.Write([]byte("body"))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	if _, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet); err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+	}
+	_, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet, WithRejectEmptyBody())
+	if !errors.Is(err, ErrEmptyBody) {
+		t.Errorf("Expected ErrEmptyBody, got %v", err)
+	}
+	for _, path := range []string{"/nocontent", "/body"} {
+		if _, _, err := CollectURL(server.URL+path, 1*time.Second, http.MethodGet, WithRejectEmptyBody()); err != nil {
+			t.Errorf("path %s returned non-nil error: %v", path, err)
+		}
+	}
+	if _, _, err := CollectURL(server.URL, 1*time.Second, http.MethodHead, WithRejectEmptyBody()); err != nil {
+		t.Errorf("CollectURL returned non-nil error: %v", err)
+	}
+}
+
+func TestCollectURLsTimestamps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	before := time.Now()
+	ucds := CollectURLs([]string{server.URL, server.URL}, 1*time.Second, http.MethodGet, 1)
+	after := time.Now()
+	// A single thread runs the requests one after the other.
+	if ucds[0].CompletedAt.After(ucds[1].StartedAt) {
+		t.Errorf("Expected sequential requests, got %+v", ucds)
+	}
+	for _, ucd := range ucds {
+		if ucd.StartedAt.Before(before) || ucd.CompletedAt.After(after) ||
+			ucd.CompletedAt.Sub(ucd.StartedAt) < 20*time.Millisecond {
+			t.Errorf("Unexpected timestamps, started:%v, completed:%v", ucd.StartedAt, ucd.CompletedAt)
+		}
+	}
+}
+
+func TestCollectURLsTimestampsNotRequested(t *testing.T) {
+	rewrite := func(urlIn string) (string, error) {
+		if strings.HasSuffix(urlIn, "/fail") {
+			return "", errors.New("no rewrite")
+		}
+		return urlIn, nil
+	}
+	urls := []string{"ftp://127.0.0.1/", "http://127.0.0.1/" + strings.Repeat("a", DefaultMaxURLLength), "http://127.0.0.1/fail"}
+	for _, ucd := range CollectURLs(urls, 1*time.Second, http.MethodGet, 1, WithURLRewrite(rewrite)) {
+		if ucd.Err == nil || !ucd.StartedAt.IsZero() || !ucd.CompletedAt.IsZero() {
+			t.Errorf("Expected zero timestamps with error, got %v, %v, error: %v", ucd.StartedAt, ucd.CompletedAt, ucd.Err)
+		}
+	}
+	for _, ucd := range CollectURLsToDir(urls[:1], t.TempDir(), 1*time.Second, 1) {
+		if ucd.Err == nil || !ucd.StartedAt.IsZero() || !ucd.CompletedAt.IsZero() {
+			t.Errorf("Expected zero timestamps with error, got %v, %v, error: %v", ucd.StartedAt, ucd.CompletedAt, ucd.Err)
+		}
+	}
+}
+
+func TestCollectURLsOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.(http.Flusher).Flush()
+			// The body never completes; it is aborted by the callback.
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var calls atomic.Int32
+	onStatus := func(url string, resp *http.Response) bool {
+		calls.Add(1)
+		return resp.StatusCode == http.StatusOK
+	}
+	urls := []string{server.URL + "/ok", server.URL + "/missing"}
+	ucds := CollectURLs(urls, 5*time.Second, http.MethodGet, 2, WithOnStatus(onStatus))
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls.Load())
+	}
+	for _, ucd := range ucds {
+		switch ucd.URL {
+		case urls[0]:
+			if ucd.Err != nil || string(ucd.Bytes) != "ok" {
+				t.Errorf("Expected ok, got %s, error: %v", ucd.Bytes, ucd.Err)
+			}
+		case urls[1]:
+			if !errors.Is(ucd.Err, ErrBodyAborted) || ucd.Response.StatusCode != http.StatusNotFound {
+				t.Errorf("Expected ErrBodyAborted with StatusNotFound, got %v", ucd.Err)
+			}
+		}
+	}
+}
+
+func TestCollectURLMaxBodySizeGzipBomb(t *testing.T) {
+	// 16MiB of zeros compresses to about 16KiB.
+	var bomb bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&bomb, gzip.BestCompression)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i < 16; i++ {
+		zw.Write(zeros)
+	}
+	zw.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte("0123456789"))
+		case "/file.gz":
+			w.Write(bomb.Bytes())
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(bomb.Bytes())
+		}
+	}))
+	defer server.Close()
+
+	max := int64(256 << 10)
+	tests := []struct {
+		url  string
+		opts []Option
+	}{
+		// Decompression by the transport, by WithCompressionReport, and by WithBodyPipeline.
+		{server.URL, []Option{WithMaxBodySize(max)}},
+		{server.URL, []Option{WithMaxBodySize(max), WithCompressionReport()}},
+		{server.URL + "/file.gz", []Option{WithMaxBodySize(max), WithBodyPipeline([]BodyTransform{GunzipTransform})}},
+	}
+	for _, test := range tests {
+		value, _, err := CollectURL(test.url, 5*time.Second, http.MethodGet, test.opts...)
+		if !errors.Is(err, ErrMaxBodySize) || int64(len(value)) != max {
+			t.Errorf("Expected ErrMaxBodySize after %d bytes, got %d bytes, error: %v", max, len(value), err)
+		}
+	}
+
+	n, _, err := CollectURLToFile(server.URL, 5*time.Second, filepath.Join(t.TempDir(), "bomb"), true, WithMaxBodySize(max))
+	if !errors.Is(err, ErrMaxBodySize) || n != max {
+		t.Errorf("Expected ErrMaxBodySize writing file after %d bytes, got %d bytes, error: %v", max, n, err)
+	}
+
+	value, _, err := CollectURL(server.URL+"/small", 5*time.Second, http.MethodGet, WithMaxBodySize(10))
+	if err != nil || string(value) != "0123456789" {
+		t.Errorf("Expected body of exactly max bytes, got %s, error: %v", value, err)
+	}
+}
+
+func TestCollectURLsContentSniffing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/html":
+			w.Write([]byte("<!DOCTYPE html><html><body>hi</body></html>"))
+		case "/png":
+			w.Write([]byte("\x89PNG\r\n\x1a\n0000"))
+		}
+	}))
+	defer server.Close()
+
+	expected := map[string]string{
+		server.URL + "/html":  "text/html; charset=utf-8",
+		server.URL + "/png":   "image/png",
+		server.URL + "/empty": "",
+	}
+	var urls []string
+	for u := range expected {
+		urls = append(urls, u)
+	}
+	for _, ucd := range CollectURLs(urls, 1*time.Second, http.MethodGet, 3, WithContentSniffing()) {
+		if ucd.Err != nil || ucd.SniffedContentType != expected[ucd.URL] ||
+			ucd.Response.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("Expected %q for %s, got %q, error: %v", expected[ucd.URL], ucd.URL, ucd.SniffedContentType, ucd.Err)
+		}
+	}
+
+	ucds := CollectURLs([]string{server.URL + "/html"}, 1*time.Second, http.MethodGet, 1)
+	if ucds[0].SniffedContentType != "" {
+		t.Errorf("Expected no sniffing without the option, got %q", ucds[0].SniffedContentType)
+	}
+}
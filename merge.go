@@ -0,0 +1,43 @@
+package httph
+
+// MergePolicy - How MergeResults chooses between results for the same URL.
+type MergePolicy int
+
+const (
+	// MergeKeepFirst keeps the first result for a URL, in the order of the sets passed.
+	MergeKeepFirst MergePolicy = iota
+	// MergeKeepNewest keeps the result with the latest CompletedAt. Ties keep the first result.
+	MergeKeepNewest
+	// MergeKeepSuccessful keeps the first result with a nil Err, or the first result if none
+	// succeeded.
+	MergeKeepSuccessful
+)
+
+// MergeResults - Merge the results of several runs, such as CollectURLs with MethodHead followed
+// by MethodGet for some of the URLs, into one result per URL. When a URL has more than one
+// result, policy chooses the one kept. Results are in the order each URL first appears.
+func MergeResults(policy MergePolicy, sets ...[]URLCollectionData) []URLCollectionData {
+	var merged []URLCollectionData
+	index := map[string]int{}
+	for _, set := range sets {
+		for _, ucd := range set {
+			i, ok := index[ucd.URL]
+			if !ok {
+				index[ucd.URL] = len(merged)
+				merged = append(merged, ucd)
+				continue
+			}
+			switch policy {
+			case MergeKeepNewest:
+				if ucd.CompletedAt.After(merged[i].CompletedAt) {
+					merged[i] = ucd
+				}
+			case MergeKeepSuccessful:
+				if merged[i].Err != nil && ucd.Err == nil {
+					merged[i] = ucd
+				}
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,47 @@
+package httph
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMergeResults(t *testing.T) {
+	now := time.Now()
+	errFail := errors.New("fail")
+	head := []URLCollectionData{
+		{URL: "a", Err: errFail, CompletedAt: now},
+		{URL: "b", CompletedAt: now.Add(2 * time.Second)},
+	}
+	get := []URLCollectionData{
+		{URL: "c", CompletedAt: now},
+		{URL: "a", CompletedAt: now.Add(time.Second)},
+		{URL: "b", Err: errFail, CompletedAt: now.Add(time.Second)},
+	}
+
+	tests := []struct {
+		policy   MergePolicy
+		expected []URLCollectionData
+	}{
+		{MergeKeepFirst, []URLCollectionData{head[0], head[1], get[0]}},
+		{MergeKeepNewest, []URLCollectionData{get[1], head[1], get[0]}},
+		{MergeKeepSuccessful, []URLCollectionData{get[1], head[1], get[0]}},
+	}
+	for _, test := range tests {
+		merged := MergeResults(test.policy, head, get)
+		if len(merged) != len(test.expected) {
+			t.Errorf("Policy %d expected %d results, got %d", test.policy, len(test.expected), len(merged))
+			continue
+		}
+		for i := range merged {
+			if merged[i].URL != test.expected[i].URL || merged[i].Err != test.expected[i].Err ||
+				!merged[i].CompletedAt.Equal(test.expected[i].CompletedAt) {
+				t.Errorf("Policy %d result %d expected %+v, got %+v", test.policy, i, test.expected[i], merged[i])
+			}
+		}
+	}
+
+	if merged := MergeResults(MergeKeepFirst); len(merged) != 0 {
+		t.Errorf("Expected no results, got %+v", merged)
+	}
+}
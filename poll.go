@@ -0,0 +1,91 @@
+package httph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+// WithRetryAfterCap - Limit a delay dictated by the server, such as the Retry-After header read
+// by PollURL, to max, so a huge value does not stall polling. max <= 0 disables (default).
+func WithRetryAfterCap(max time.Duration) Option {
+	return func(o *options) {
+		o.retryAfterCap = max
+	}
+}
+
+// PollURL - Repeatedly make a MethodGet request to urlIn, calling handler with each result,
+// until handler returns false (nil is returned) or ctx is done (ctx.Err() is returned).
+// The delay before the next request is read from the response header named header, using
+// parse (such as ParseDelay); if the header is missing, can not be parsed, is negative, or the
+// request failed, defaultDelay is used. The delay from the header is limited by WithRetryAfterCap.
+func PollURL(ctx context.Context, urlIn string, timeout time.Duration, header string,
+	parse func(value string) (time.Duration, error), defaultDelay time.Duration,
+	handler func(ucd URLCollectionData) bool, opts ...Option) error {
+	o := newOptions(opts)
+	client := newClient(timeout, false, o)
+	defer client.CloseIdleConnections()
+
+	for {
+		ucd := collectURL(ctx, client, urlIn, http.MethodGet, o)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !handler(ucd) {
+			return nil
+		}
+
+		delay := defaultDelay
+		if ucd.Err == nil {
+			if value := ucd.Response.Header.Get(header); value != "" {
+				if d, err := parse(value); err != nil {
+					logh.Map[appName].Printf(logh.Warning, "PollURL error parsing %s:%v", header, err)
+				} else if d < 0 {
+					logh.Map[appName].Printf(logh.Warning, "PollURL negative %s delay:%v", header, d)
+				} else {
+					delay = d
+					if o.retryAfterCap > 0 && delay > o.retryAfterCap {
+						logh.Map[appName].Printf(logh.Warning, "PollURL %s delay:%v capped to:%v", header, delay, o.retryAfterCap)
+						delay = o.retryAfterCap
+					}
+				}
+			}
+		}
+		logh.Map[appName].Printf(logh.Debug, "PollURL url:%s, next poll in:%v", urlIn, delay)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// ParseDelay - Parse a header value that is either a non-negative integer number of seconds, or
+// an HTTP date, as used by Retry-After (RFC 9110), into the delay from now. A date in the past
+// returns 0. A number of seconds too large for a time.Duration returns an error.
+func ParseDelay(value string) (time.Duration, error) {
+	if value != "" && strings.Trim(value, "0123456789") == "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds > math.MaxInt64/int64(time.Second) {
+			return 0, fmt.Errorf("delay out of range: %s seconds", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, err
+	}
+	if d := time.Until(t); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
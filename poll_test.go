@@ -0,0 +1,103 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPollURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Poll-After", "0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var polls []time.Time
+	handler := func(ucd URLCollectionData) bool {
+		if ucd.Err != nil {
+			t.Errorf("PollURL returned non-nil error: %v", ucd.Err)
+		}
+		polls = append(polls, time.Now())
+		return len(polls) < 3
+	}
+	err := PollURL(context.Background(), server.URL, 1*time.Second, "X-Poll-After", ParseDelay, time.Hour, handler)
+	if err != nil {
+		t.Errorf("PollURL returned non-nil error: %v", err)
+	}
+	if len(polls) != 3 {
+		t.Errorf("Expected 3 polls, got %d", len(polls))
+		return
+	}
+	if d := polls[2].Sub(polls[0]); d > time.Second {
+		t.Errorf("Expected server advertised delay, not the default, got %v", d)
+	}
+
+	// The default delay is used when the header is missing.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	polls = nil
+	err = PollURL(ctx, server.URL, 1*time.Second, "X-Missing", ParseDelay, time.Hour, handler)
+	if !errors.Is(err, context.DeadlineExceeded) || len(polls) != 1 {
+		t.Errorf("Expected 1 poll and context.DeadlineExceeded, got %d polls, error: %v", len(polls), err)
+	}
+}
+
+func TestPollURLRetryAfterCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	polls := 0
+	handler := func(ucd URLCollectionData) bool {
+		polls++
+		return polls < 3
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := PollURL(ctx, server.URL, 1*time.Second, "Retry-After", ParseDelay, time.Hour, handler,
+		WithRetryAfterCap(10*time.Millisecond))
+	if err != nil || polls != 3 {
+		t.Errorf("Expected 3 polls with capped delay, got %d polls, error: %v", polls, err)
+	}
+
+	// Out of range and negative delays use the default delay, rather than polling without delay.
+	overflow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "99999999999")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer overflow.Close()
+	negative := func(string) (time.Duration, error) { return -time.Hour, nil }
+	for _, parse := range []func(string) (time.Duration, error){ParseDelay, negative} {
+		polls = 0
+		start := time.Now()
+		err = PollURL(context.Background(), overflow.URL, 1*time.Second, "Retry-After", parse, 50*time.Millisecond,
+			handler, WithRetryAfterCap(time.Hour))
+		if elapsed := time.Since(start); err != nil || polls != 3 || elapsed < 100*time.Millisecond {
+			t.Errorf("Expected 3 polls with the default delay, got %d polls in %v, error: %v", polls, elapsed, err)
+		}
+	}
+}
+
+func TestParseDelay(t *testing.T) {
+	if d, err := ParseDelay("120"); err != nil || d != 120*time.Second {
+		t.Errorf("Expected 120s, got %v, error: %v", d, err)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d, err := ParseDelay(future); err != nil || d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Expected 1h, got %v, error: %v", d, err)
+	}
+	for _, value := range []string{"soon", "0.05", "-1", "1e11", "inf", "NaN", "99999999999", "99999999999999999999"} {
+		if d, err := ParseDelay(value); err == nil {
+			t.Errorf("Expected error for invalid value %s, got %v", value, d)
+		}
+	}
+	if d, err := ParseDelay("9223372036"); err != nil || d != 9223372036*time.Second {
+		t.Errorf("Expected max delay, got %v, error: %v", d, err)
+	}
+}
@@ -0,0 +1,172 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+var (
+	// ErrRangeResponse is returned when a range request does not return StatusPartialContent
+	// with a Content-Range matching the requested range.
+	ErrRangeResponse = errors.New("invalid range response")
+	// ErrRangeUnknownLength is returned by CollectURLRanges when the length of the resource can
+	// not be determined.
+	ErrRangeUnknownLength = errors.New("content length unknown")
+)
+
+const (
+	// defaultMaxRangesLength is the largest body CollectURLRanges allocates when WithMaxBodySize
+	// is not set.
+	defaultMaxRangesLength = 4 << 30
+)
+
+// CollectURLRange - Pass in a URL, request timeout, and the first and last (inclusive) byte
+// offsets, and get back that range of the body. The response must be StatusPartialContent with a
+// Content-Range starting at start; the server may shorten the range if end is past the end of
+// the resource. Otherwise ErrRangeResponse is returned.
+func CollectURLRange(urlIn string, timeout time.Duration, start, end int64, opts ...Option) ([]byte, *http.Response, error) {
+	o := newOptions(opts)
+	client := newClient(timeout, false, o)
+	defer client.CloseIdleConnections()
+	return collectURLRange(context.Background(), client, urlIn, start, end, o)
+}
+
+// CollectURLRanges - Download urlIn using parts number of parallel range requests, and return
+// the reassembled body. The length of the body is determined with a MethodHead request; if
+// the server does not return a Content-Length, ErrRangeUnknownLength is returned. A length
+// larger than WithMaxBodySize, or 4GiB when it is not set, returns ErrMaxBodySize without
+// allocating the body. So that a resource that changes during the download is not reassembled
+// from two versions, each range request is sent with If-Range when the MethodHead response has a
+// strong ETag, and each part must have the same ETag and total length as the MethodHead response;
+// otherwise ErrRangeResponse is returned.
+func CollectURLRanges(urlIn string, timeout time.Duration, parts int, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	client := newClient(timeout, false, o)
+	defer client.CloseIdleConnections()
+	ucd := collectURL(context.Background(), client, urlIn, http.MethodHead, o)
+	if ucd.Err != nil {
+		return nil, ucd.Err
+	}
+	length := ucd.Response.ContentLength
+	if length < 0 {
+		return nil, ErrRangeUnknownLength
+	}
+	if length == 0 {
+		return []byte{}, nil
+	}
+	maxLength := int64(defaultMaxRangesLength)
+	if o.maxBodySize > 0 {
+		maxLength = o.maxBodySize
+	}
+	if length > maxLength || length > math.MaxInt {
+		err := fmt.Errorf("%w: content length %d > %d", ErrMaxBodySize, length, maxLength)
+		logh.Map[appName].Printf(logh.Warning, "CollectURLRanges url:%s, %v", urlIn, err)
+		return nil, err
+	}
+	etag := ucd.Response.Header.Get("ETag")
+	ro := *o
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		// Only a strong ETag can be used with If-Range.
+		ro.header = ro.header.Clone()
+		if ro.header == nil {
+			ro.header = http.Header{}
+		}
+		ro.header.Set("If-Range", etag)
+	}
+	if int64(parts) > length {
+		parts = int(length)
+	}
+	if parts < 1 {
+		parts = 1
+	}
+
+	body := make([]byte, length)
+	partSize := length / int64(parts)
+	errs := make([]error, parts)
+	var wg sync.WaitGroup
+	for i := 0; i < parts; i++ {
+		start := int64(i) * partSize
+		end := start + partSize - 1
+		if i == parts-1 {
+			end = length - 1
+		}
+		wg.Add(1)
+		go func(i int, start, end int64) {
+			defer wg.Done()
+			b, resp, err := collectURLRange(context.Background(), client, urlIn, start, end, &ro)
+			if err == nil && int64(len(b)) != end-start+1 {
+				err = fmt.Errorf("%w: expected %d bytes, got %d", ErrRangeResponse, end-start+1, len(b))
+			}
+			if err == nil {
+				err = checkRangePart(resp, length, etag)
+			}
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			copy(body[start:], b)
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// checkRangePart - Check the response for a part of CollectURLRanges is for the same resource as
+// the MethodHead response, with the total length and ETag given.
+func checkRangePart(resp *http.Response, length int64, etag string) error {
+	var start, end, total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || total != length {
+		return fmt.Errorf("%w: Content-Range %q does not match length %d", ErrRangeResponse,
+			resp.Header.Get("Content-Range"), length)
+	}
+	if partETag := resp.Header.Get("ETag"); partETag != etag {
+		return fmt.Errorf("%w: ETag %q does not match %q", ErrRangeResponse, partETag, etag)
+	}
+	return nil
+}
+
+// collectURLRange - Implementation of CollectURLRange.
+func collectURLRange(ctx context.Context, client *http.Client, urlIn string, start, end int64, o *options) ([]byte, *http.Response, error) {
+	ro := *o
+	ro.header = ro.header.Clone()
+	if ro.header == nil {
+		ro.header = http.Header{}
+	}
+	ro.header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	ucd := collectURL(ctx, client, urlIn, http.MethodGet, &ro)
+	b, resp, err := ucd.Bytes, ucd.Response, ucd.Err
+	if err != nil {
+		return b, resp, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		err = fmt.Errorf("%w: status %d", ErrRangeResponse, resp.StatusCode)
+		logh.Map[appName].Printf(logh.Warning, "%v", err)
+		return b, resp, err
+	}
+	var crStart, crEnd int64
+	var crLength string
+	_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%s", &crStart, &crEnd, &crLength)
+	if err != nil || crStart != start || crEnd > end || int64(len(b)) != crEnd-crStart+1 {
+		err = fmt.Errorf("%w: requested %d-%d, Content-Range %q, %d bytes", ErrRangeResponse, start, end,
+			resp.Header.Get("Content-Range"), len(b))
+		logh.Map[appName].Printf(logh.Warning, "%v", err)
+		return b, resp, err
+	}
+
+	return b, resp, nil
+}
@@ -0,0 +1,110 @@
+package httph
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/norange" {
+			w.Write([]byte(content))
+			return
+		}
+		http.ServeContent(w, r, "content", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	value, response, err := CollectURLRange(server.URL, 1*time.Second, 10, 14)
+	if err != nil {
+		t.Errorf("CollectURLRange returned non-nil error: %v", err)
+		return
+	}
+	if string(value) != content[10:15] {
+		t.Errorf("Expected %s, got %s", content[10:15], value)
+	}
+	if response.StatusCode != http.StatusPartialContent {
+		t.Errorf("incorrect status, expected %d, got %d", http.StatusPartialContent, response.StatusCode)
+	}
+
+	// The server shortens a range past the end.
+	value, _, err = CollectURLRange(server.URL, 1*time.Second, 995, 2000)
+	if err != nil || string(value) != content[995:] {
+		t.Errorf("Expected %s, got %s, error: %v", content[995:], value, err)
+	}
+
+	_, _, err = CollectURLRange(server.URL+"/norange", 1*time.Second, 10, 14)
+	if !errors.Is(err, ErrRangeResponse) {
+		t.Errorf("Expected ErrRangeResponse, got %v", err)
+	}
+}
+
+func TestCollectURLRanges(t *testing.T) {
+	content := strings.Repeat("0123456789", 100) + "0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "content", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	value, err := CollectURLRanges(server.URL, 1*time.Second, 4)
+	if err != nil {
+		t.Errorf("CollectURLRanges returned non-nil error: %v", err)
+		return
+	}
+	if !bytes.Equal(value, []byte(content)) {
+		t.Errorf("Reassembled body does not match, got %d bytes", len(value))
+	}
+}
+
+func TestCollectURLRangesHostileLength(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		length := "9223372036854775000"
+		if r.URL.Path == "/large" {
+			length = "10000000000"
+		}
+		w.Header().Set("Content-Length", length)
+	}))
+	defer server.Close()
+
+	for _, u := range []string{server.URL, server.URL + "/large"} {
+		if _, err := CollectURLRanges(u, 1*time.Second, 4); !errors.Is(err, ErrMaxBodySize) {
+			t.Errorf("Expected ErrMaxBodySize for %s, got %v", u, err)
+		}
+		if _, err := CollectURLRanges(u, 1*time.Second, 4, WithMaxBodySize(1024)); !errors.Is(err, ErrMaxBodySize) {
+			t.Errorf("Expected ErrMaxBodySize with WithMaxBodySize for %s, got %v", u, err)
+		}
+	}
+}
+
+func TestCollectURLRangesChanged(t *testing.T) {
+	v1, v2 := strings.Repeat("a", 1000), strings.Repeat("b", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The resource changes after the MethodHead request.
+		content, etag := v2, `"v2"`
+		if r.Method == http.MethodHead {
+			content, etag = v1, `"v1"`
+		}
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", etag)
+		case "/length":
+			if r.Method == http.MethodGet {
+				content += "b"
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, u := range []string{server.URL + "/etag", server.URL + "/length"} {
+		if _, err := CollectURLRanges(u, 1*time.Second, 4); !errors.Is(err, ErrRangeResponse) {
+			t.Errorf("Expected ErrRangeResponse for %s, got %v", u, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package httph
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/paulfdunn/logh"
+)
+
+var (
+	// ErrCheckRedirectPanic is returned when the function supplied with WithCheckRedirect panics.
+	ErrCheckRedirectPanic = errors.New("check redirect panic")
+)
+
+// WithCheckRedirect - Use checkRedirect as the http.Client.CheckRedirect redirect policy. If
+// checkRedirect panics, the panic is recovered and the request fails with ErrCheckRedirectPanic,
+// rather than crashing the program.
+func WithCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) Option {
+	return func(o *options) {
+		o.checkRedirect = checkRedirect
+	}
+}
+
+// recoverCheckRedirect - Wrap checkRedirect, converting a panic to an error.
+func recoverCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrCheckRedirectPanic, r)
+				logh.Map[appName].Printf(logh.Error, "url:%s, %v", req.URL, err)
+			}
+		}()
+		return checkRedirect(req, via)
+	}
+}
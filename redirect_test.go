@@ -0,0 +1,41 @@
+package httph
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLCheckRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sameHost := func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != via[0].URL.Host {
+			return errors.New("different host")
+		}
+		return nil
+	}
+	_, response, err := CollectURL(server.URL+"/redirect", 1*time.Second, http.MethodGet, WithCheckRedirect(sameHost))
+	if err != nil || response.Request.URL.Path != "/target" {
+		t.Errorf("Expected redirect to be followed, got error: %v", err)
+	}
+
+	panics := func(req *http.Request, via []*http.Request) error {
+		var m map[string]bool
+		m["panic"] = true
+		return nil
+	}
+	_, _, err = CollectURL(server.URL+"/redirect", 1*time.Second, http.MethodGet, WithCheckRedirect(panics))
+	if !errors.Is(err, ErrCheckRedirectPanic) {
+		t.Errorf("Expected ErrCheckRedirectPanic, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+var (
+	// ErrResumableDownload is returned by ResumableDownload when the response is not usable, or
+	// the downloaded file does not match the size reported by the server.
+	ErrResumableDownload = errors.New("resumable download failed")
+)
+
+const (
+	// partialSuffix and etagSuffix are appended to the destination path of ResumableDownload, for
+	// the partial file and the ETag of the partial file.
+	partialSuffix = ".partial"
+	etagSuffix    = ".etag"
+)
+
+// ResumableDownload - Download urlIn to destPath, resuming a previous download that did not
+// complete. The body is written to destPath + ".partial", with the response ETag saved in
+// destPath + ".etag", and the partial file is renamed to destPath once complete. When called
+// with an existing partial file, the rest of the body is requested with "Range: bytes=N-" and
+// "If-Range: <ETag>", and appended to the partial file; if the resource changed, the server
+// returns the whole body, and the download restarts from the beginning. A partial response
+// with a different ETag, from a server that ignores If-Range, also restarts the download.
+// Without a strong ETag a download can not be resumed safely, so it restarts. The size of the
+// file is checked against the size reported by the server. Returns the size of the file.
+// timeout applies to each request, so it must be long enough for the remaining bytes to be
+// received.
+func ResumableDownload(urlIn string, destPath string, timeout time.Duration, opts ...Option) (int64, error) {
+	o := newOptions(opts)
+	// Range offsets refer to the bytes sent, so bodies must not be decompressed.
+	client := newClient(timeout, true, o)
+	defer client.CloseIdleConnections()
+
+	partialPath, etagPath := destPath+partialSuffix, destPath+etagSuffix
+	var offset int64
+	var etag string
+	if fi, err := os.Stat(partialPath); err == nil {
+		if b, err := os.ReadFile(etagPath); err == nil && fi.Size() > 0 {
+			offset, etag = fi.Size(), string(b)
+		}
+	}
+
+	ro := *o
+	ro.header = ro.header.Clone()
+	if ro.header == nil {
+		ro.header = http.Header{}
+	}
+	if offset > 0 {
+		ro.header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		ro.header.Set("If-Range", etag)
+	}
+	req, err := newRequest(context.Background(), urlIn, http.MethodGet, &ro)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logh.Map[appName].Printf(logh.Warning, "ResumableDownload client error:%v", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var size int64
+	flag := os.O_CREATE | os.O_WRONLY
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent && resp.Header.Get("ETag") != etag:
+		// The server ignored If-Range, and the rest of a different resource can not be appended.
+		logh.Map[appName].Printf(logh.Info, "ResumableDownload url:%s, ETag changed, restarting", urlIn)
+		resp.Body.Close()
+		for _, path := range []string{partialPath, etagPath} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+		return ResumableDownload(urlIn, destPath, timeout, opts...)
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		var start, end int64
+		_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+		if err != nil || start != offset {
+			return 0, fmt.Errorf("%w: requested offset %d, Content-Range %q", ErrResumableDownload, offset,
+				resp.Header.Get("Content-Range"))
+		}
+		flag |= os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable &&
+		resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset):
+		// The partial file is already complete.
+		return offset, finishDownload(partialPath, etagPath, destPath)
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			logh.Map[appName].Printf(logh.Info, "ResumableDownload url:%s, resource changed, restarting", urlIn)
+		}
+		size = resp.ContentLength
+		flag |= os.O_TRUNC
+		// Only a strong ETag can be used with If-Range.
+		etag = resp.Header.Get("ETag")
+		if etag == "" || strings.HasPrefix(etag, "W/") {
+			err = os.Remove(etagPath)
+		} else {
+			err = os.WriteFile(etagPath, []byte(etag), 0644)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("%w: status %d", ErrResumableDownload, resp.StatusCode)
+	}
+
+	var digest *digestVerifier
+	if o.verifyContentDigest {
+		if digest, err = newDigestVerifier(resp); err != nil {
+			logh.Map[appName].Printf(logh.Warning, "ResumableDownload url:%s, %v", urlIn, err)
+			return 0, err
+		}
+	}
+
+	f, err := os.OpenFile(partialPath, flag, 0644)
+	if err != nil {
+		logh.Map[appName].Printf(logh.Error, "ResumableDownload error opening file:%v", err)
+		return 0, err
+	}
+	var w io.Writer = f
+	if digest != nil {
+		w = io.MultiWriter(f, digest)
+	}
+	_, err = io.Copy(w, o.limitBody(resp.Body))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && digest != nil {
+		if err = digest.verify(); err != nil {
+			// The partial file can not be trusted, so the next download starts from the beginning.
+			os.Remove(partialPath)
+			os.Remove(etagPath)
+		}
+	}
+	if err != nil {
+		logh.Map[appName].Printf(logh.Warning, "ResumableDownload url:%s, error:%v", urlIn, err)
+		return 0, err
+	}
+	fi, err := os.Stat(partialPath)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 && fi.Size() != size {
+		return fi.Size(), fmt.Errorf("%w: expected %d bytes, file has %d", ErrResumableDownload, size, fi.Size())
+	}
+	return fi.Size(), finishDownload(partialPath, etagPath, destPath)
+}
+
+// finishDownload - Move a completed partial file to destPath, and remove the ETag file.
+func finishDownload(partialPath, etagPath, destPath string) error {
+	if err := os.Rename(partialPath, destPath); err != nil {
+		return err
+	}
+	if err := os.Remove(etagPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
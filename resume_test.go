@@ -0,0 +1,99 @@
+package httph
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumableDownload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	etag := `"v1"`
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	check := func(name string, n int64, err error, expectedRanges ...string) {
+		t.Helper()
+		b, rerr := os.ReadFile(dest)
+		if err != nil || rerr != nil || n != int64(len(content)) || !bytes.Equal(b, content) {
+			t.Errorf("%s: expected complete file, got %d bytes, error: %v, read error: %v", name, n, err, rerr)
+		}
+		if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: expected partial file removed, got %v", name, err)
+		}
+		if _, err := os.Stat(dest + etagSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: expected ETag file removed, got %v", name, err)
+		}
+		if strings.Join(ranges, ",") != strings.Join(expectedRanges, ",") {
+			t.Errorf("%s: expected ranges %v, got %v", name, expectedRanges, ranges)
+		}
+		ranges = nil
+		os.Remove(dest)
+	}
+
+	n, err := ResumableDownload(server.URL, dest, 1*time.Second)
+	check("fresh", n, err, "")
+
+	// Interrupt the download after 300 bytes, then resume.
+	_, err = ResumableDownload(server.URL, dest, 1*time.Second, WithMaxBodySize(300))
+	if !errors.Is(err, ErrMaxBodySize) {
+		t.Errorf("Expected ErrMaxBodySize, got %v", err)
+	}
+	n, err = ResumableDownload(server.URL, dest, 1*time.Second)
+	check("resumed", n, err, "", "bytes=300-")
+
+	// The resource changes between attempts, so the download restarts.
+	ResumableDownload(server.URL, dest, 1*time.Second, WithMaxBodySize(300))
+	etag = `"v2"`
+	content = []byte(strings.Repeat("abcdefghij", 100))
+	n, err = ResumableDownload(server.URL, dest, 1*time.Second)
+	check("changed", n, err, "", "bytes=300-")
+
+	// The partial file is already complete.
+	os.WriteFile(dest+partialSuffix, content, 0644)
+	os.WriteFile(dest+etagSuffix, []byte(etag), 0644)
+	n, err = ResumableDownload(server.URL, dest, 1*time.Second)
+	check("complete", n, err, "bytes=1000-")
+}
+
+func TestResumableDownloadIfRangeIgnored(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	etag := `"v1"`
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		// The server does not support If-Range, so it always returns the requested range.
+		r.Header.Del("If-Range")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	ResumableDownload(server.URL, dest, 1*time.Second, WithMaxBodySize(300))
+	etag = `"v2"`
+	content = []byte(strings.Repeat("abcdefghij", 100))
+	n, err := ResumableDownload(server.URL, dest, 1*time.Second)
+	b, rerr := os.ReadFile(dest)
+	if err != nil || rerr != nil || n != int64(len(content)) || !bytes.Equal(b, content) {
+		t.Errorf("Expected complete file, got %d bytes, error: %v, read error: %v", n, err, rerr)
+	}
+	if strings.Join(ranges, ",") != ",bytes=300-," {
+		t.Errorf("Expected ranges [ bytes=300- ], got %v", ranges)
+	}
+	if _, err := os.Stat(dest + etagSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected ETag file removed, got %v", err)
+	}
+}
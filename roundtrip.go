@@ -0,0 +1,46 @@
+package httph
+
+import (
+	"net/http"
+)
+
+// WithOutgoingHeaderAllowlist - Remove every request header not in allow immediately before
+// each request, including redirects, is sent. User-Agent is not sent unless allowed. Headers
+// that net/http writes itself, rather than taking from http.Request.Header (Host,
+// Content-Length, Transfer-Encoding, Trailer, Accept-Encoding, Connection), are not affected.
+func WithOutgoingHeaderAllowlist(allow []string) Option {
+	return func(o *options) {
+		o.headerAllowlist = map[string]bool{}
+		for _, h := range allow {
+			o.headerAllowlist[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// headerAllowlistTransport - An http.RoundTripper that removes headers not in allow.
+type headerAllowlistTransport struct {
+	rt    http.RoundTripper
+	allow map[string]bool
+}
+
+func (t *headerAllowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request.
+	r := req.Clone(req.Context())
+	for k := range r.Header {
+		if !t.allow[k] {
+			delete(r.Header, k)
+		}
+	}
+	if !t.allow["User-Agent"] {
+		// An empty User-Agent prevents net/http sending its default.
+		r.Header["User-Agent"] = []string{""}
+	}
+	return t.rt.RoundTrip(r)
+}
+
+// CloseIdleConnections - Forward to the wrapped RoundTripper, so http.Client.CloseIdleConnections works.
+func (t *headerAllowlistTransport) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,39 @@
+package httph
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLOutgoingHeaderAllowlist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for k := range r.Header {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strings.Join(names, " ")))
+	}))
+	defer server.Close()
+
+	value, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet)
+	if err != nil || !strings.Contains(string(value), "User-Agent") {
+		t.Errorf("Expected User-Agent by default, got %s, error: %v", value, err)
+	}
+
+	// Connection is written by net/http because the request is not keep-alive.
+	value, _, err = CollectURL(server.URL, 1*time.Second, http.MethodGet, WithOutgoingHeaderAllowlist(nil))
+	if expected := "Accept-Encoding Connection"; err != nil || string(value) != expected {
+		t.Errorf("Expected %s, got %s, error: %v", expected, value, err)
+	}
+
+	value, _, err = CollectURLRange(server.URL, 1*time.Second, 0, 1, WithOutgoingHeaderAllowlist([]string{"range"}))
+	if expected := "Connection Range"; string(value) != expected {
+		t.Errorf("Expected %s, got %s, error: %v", expected, value, err)
+	}
+}
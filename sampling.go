@@ -0,0 +1,110 @@
+package httph
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+// WithErrorSampling - Collapse repeated, identical, request errors to the same host into
+// periodic summaries, so a host that goes down during a large batch does not flood the log. The
+// host is the one requested, after WithURLRewrite.
+// The first occurrence of an error is logged; further occurrences are counted, and logged as a
+// summary, such as "CollectURL client error host:example.com:80, dial tcp: connection refused:
+// 512 occurrences in last 5s", at the first occurrence after interval has passed, and when a
+// CollectURLs batch completes. interval <= 0 disables (default).
+func WithErrorSampling(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.errorSampler = &errorSampler{interval: interval, samples: map[errorSampleKey]*errorSample{},
+				printf: func(format string, v ...interface{}) {
+					logh.Map[appName].Printf(logh.Warning, format, v...)
+				}}
+		} else {
+			o.errorSampler = nil
+		}
+	}
+}
+
+// logClientError - Log the client error of a request for urlIn, per WithErrorSampling. prefix
+// is the name of the calling function.
+func (o *options) logClientError(prefix string, urlIn string, err error) {
+	if o.errorSampler == nil {
+		logh.Map[appName].Printf(logh.Warning, "%s client error:%v", prefix, err)
+		return
+	}
+	o.errorSampler.log(prefix, urlIn, err)
+}
+
+// errorSampleKey - Errors are identical when they have the same key.
+type errorSampleKey struct {
+	prefix string
+	host   string
+	err    string
+}
+
+type errorSample struct {
+	start time.Time
+	count int
+}
+
+// errorSampler - Counts identical errors, and logs summaries; see WithErrorSampling.
+type errorSampler struct {
+	interval time.Duration
+	// printf logs at Warning level.
+	printf  func(format string, v ...interface{})
+	mu      sync.Mutex
+	samples map[errorSampleKey]*errorSample
+}
+
+func (es *errorSampler) log(prefix string, urlIn string, err error) {
+	key := errorSampleKey{prefix: prefix, err: err.Error()}
+	if u, perr := url.Parse(urlIn); perr == nil {
+		key.host = u.Host
+	}
+	// The url.Error returned by http.Client includes the URL, so only the cause is compared. Its
+	// URL is the one actually requested, after WithURLRewrite or a redirect, so its host is used.
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		key.err = uerr.Err.Error()
+		if u, perr := url.Parse(uerr.URL); perr == nil {
+			key.host = u.Host
+		}
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	now := time.Now()
+	sample, ok := es.samples[key]
+	if !ok {
+		es.samples[key] = &errorSample{start: now}
+		es.printf("%s client error:%v", prefix, err)
+		return
+	}
+	sample.count++
+	if now.Sub(sample.start) >= es.interval {
+		es.logSummary(key, sample, now)
+		sample.start, sample.count = now, 0
+	}
+}
+
+// flush - Log summaries of all counted errors, and reset the counts.
+func (es *errorSampler) flush() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	now := time.Now()
+	for key, sample := range es.samples {
+		if sample.count > 0 {
+			es.logSummary(key, sample, now)
+		}
+	}
+	es.samples = map[errorSampleKey]*errorSample{}
+}
+
+func (es *errorSampler) logSummary(key errorSampleKey, sample *errorSample, now time.Time) {
+	es.printf("%s client error host:%s, %s: %d occurrences in last %v",
+		key.prefix, key.host, key.err, sample.count, now.Sub(sample.start).Round(time.Millisecond))
+}
@@ -0,0 +1,75 @@
+package httph
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCollectURLsErrorSampling(t *testing.T) {
+	// A closed listener gives connection refused errors.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := "http://" + l.Addr().String()
+	l.Close()
+
+	var mu sync.Mutex
+	var logs []string
+	capture := func(o *options) {
+		o.errorSampler.printf = func(format string, v ...interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, fmt.Sprintf(format, v...))
+		}
+	}
+	var urls []string
+	for i := 0; i < 100; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", down, i))
+	}
+	ucds := CollectURLs(urls, 1*time.Second, http.MethodGet, 4, WithErrorSampling(time.Hour), capture)
+	for _, ucd := range ucds {
+		if ucd.Err == nil {
+			t.Errorf("Expected error for %s", ucd.URL)
+		}
+	}
+
+	// The first error, then a summary of the rest when the batch completes.
+	if len(logs) != 2 || !strings.Contains(logs[0], "connection refused") ||
+		!strings.Contains(logs[1], "host:"+l.Addr().String()) || !strings.Contains(logs[1], ": 99 occurrences in last") {
+		t.Errorf("Unexpected logs: %v", logs)
+	}
+
+	// The host is the one requested, after rewriting.
+	logs = nil
+	rewrite := func(urlIn string) (string, error) {
+		return strings.Replace(urlIn, "http://production.example.com", down, 1), nil
+	}
+	CollectURLs([]string{"http://production.example.com/a", "http://production.example.com/b"}, 1*time.Second,
+		http.MethodGet, 1, WithErrorSampling(time.Hour), capture, WithURLRewrite(rewrite))
+	if len(logs) != 2 || !strings.Contains(logs[1], "host:"+l.Addr().String()+",") {
+		t.Errorf("Expected summary for the rewritten host, got: %v", logs)
+	}
+}
+
+func TestErrorSamplerInterval(t *testing.T) {
+	var logs []string
+	es := &errorSampler{interval: 50 * time.Millisecond, samples: map[errorSampleKey]*errorSample{},
+		printf: func(format string, v ...interface{}) { logs = append(logs, fmt.Sprintf(format, v...)) }}
+	err := fmt.Errorf("refused")
+	for i := 0; i < 3; i++ {
+		es.log("CollectURL", "http://a.example.com/", err)
+	}
+	es.log("CollectURL", "http://b.example.com/", err)
+	time.Sleep(60 * time.Millisecond)
+	es.log("CollectURL", "http://a.example.com/", err)
+	es.flush()
+	if len(logs) != 3 || !strings.Contains(logs[2], "host:a.example.com, refused: 3 occurrences") {
+		t.Errorf("Unexpected logs: %v", logs)
+	}
+}
@@ -0,0 +1,95 @@
+package httph
+
+import (
+	"context"
+	"sync"
+)
+
+// WithMemoryBudget - Bound the number of body bytes being read concurrently to budget bytes.
+// Before reading a body, a request waits until its Content-Length (or the whole budget, if
+// the length is unknown or larger than the budget) is available, and releases it when the body
+// has been read. The budget is shared by all requests made with the Options it is applied to:
+// a CollectURLs batch, or all requests made by a Collector.
+// Note this bounds peak memory used by bodies in flight; CollectURLs still returns all bodies.
+func WithMemoryBudget(budget int64) Option {
+	return func(o *options) {
+		o.memoryBudget = newByteSemaphore(budget)
+	}
+}
+
+// byteSemaphore - A weighted semaphore; waiters are served in FIFO order.
+type byteSemaphore struct {
+	mu      sync.Mutex
+	size    int64
+	cur     int64
+	waiters []*semaphoreWaiter
+}
+
+type semaphoreWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func newByteSemaphore(size int64) *byteSemaphore {
+	return &byteSemaphore{size: size}
+}
+
+// acquire - Acquire n, which is clamped to the size of the semaphore, blocking until it is
+// available or ctx is done. Returns the amount acquired, which must be passed to release.
+func (s *byteSemaphore) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > s.size || n < 0 {
+		n = s.size
+	}
+	s.mu.Lock()
+	if s.size-s.cur >= n && len(s.waiters) == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return n, nil
+	}
+	w := &semaphoreWaiter{n: n, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return n, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Acquired while ctx was being cancelled.
+			s.cur -= n
+		default:
+			for i, sw := range s.waiters {
+				if sw == w {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		s.notify()
+		return 0, ctx.Err()
+	}
+}
+
+// release - Release n previously returned by acquire.
+func (s *byteSemaphore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	s.notify()
+}
+
+// notify - Wake waiters, in order, while there is room. Must be called with mu held.
+func (s *byteSemaphore) notify() {
+	for len(s.waiters) > 0 {
+		w := s.waiters[0]
+		if s.size-s.cur < w.n {
+			break
+		}
+		s.cur += w.n
+		s.waiters = s.waiters[1:]
+		close(w.ready)
+	}
+}
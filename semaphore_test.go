@@ -0,0 +1,131 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestByteSemaphore(t *testing.T) {
+	s := newByteSemaphore(10)
+	n, err := s.acquire(context.Background(), 6)
+	if n != 6 || err != nil {
+		t.Errorf("acquire returned n:%d, err:%v", n, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, 6); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	acquired := make(chan int64)
+	go func() {
+		// Unknown lengths acquire the whole budget.
+		n, _ := s.acquire(context.Background(), -1)
+		acquired <- n
+	}()
+	select {
+	case <-acquired:
+		t.Errorf("acquire did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.release(6)
+	if n := <-acquired; n != 10 {
+		t.Errorf("Expected 10, got %d", n)
+	}
+	s.release(10)
+	if s.cur != 0 || len(s.waiters) != 0 {
+		t.Errorf("Expected empty semaphore, got cur:%d, waiters:%d", s.cur, len(s.waiters))
+	}
+}
+
+func TestCollectURLsMemoryBudget(t *testing.T) {
+	chunk := []byte(strings.Repeat("0123456789abcdef", 64))
+	chunks := 4
+	bodySize := int64(len(chunk) * chunks)
+	var inBody, maxInBody int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.FormatInt(bodySize, 10))
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Connections are unbuffered, so a flush returns once the client has read the bytes
+		// flushed. The body is in flight from the first chunk being read, to the last chunk
+		// being written.
+		w.Write(chunk)
+		w.(http.Flusher).Flush()
+		n := atomic.AddInt32(&inBody, 1)
+		for m := atomic.LoadInt32(&maxInBody); n > m && !atomic.CompareAndSwapInt32(&maxInBody, m, n); {
+			m = atomic.LoadInt32(&maxInBody)
+		}
+		for i := 1; i < chunks-1; i++ {
+			time.Sleep(10 * time.Millisecond)
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+		atomic.AddInt32(&inBody, -1)
+		w.Write(chunk)
+	}))
+	l := &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	urls := []string{server.URL, server.URL, server.URL, server.URL}
+	budget := 2 * bodySize
+	ucds := CollectURLs(urls, 5*time.Second, http.MethodGet, 4, WithMemoryBudget(budget),
+		WithTransport(&http.Transport{DialContext: l.dial}))
+	for _, ucd := range ucds {
+		if ucd.Err != nil || int64(len(ucd.Bytes)) != bodySize {
+			t.Errorf("Expected %d bytes, got %d, error: %v", bodySize, len(ucd.Bytes), ucd.Err)
+		}
+	}
+	if m := atomic.LoadInt32(&maxInBody); m < 1 || int64(m) > budget/bodySize {
+		t.Errorf("Expected at most %d bodies in flight, got %d", budget/bodySize, m)
+	}
+}
+
+// pipeListener - A net.Listener of unbuffered, in memory, connections made by dial.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (l *pipeListener) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,103 @@
+package httph
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signer - A Signer authenticates a request, typically by adding headers. Sign is called
+// before each request, including redirects, is sent. WithOutgoingHeaderAllowlist is applied
+// after Sign, so the headers Sign adds, such as Authorization and X-Date for HMACSigner, must be
+// in the allowlist to be sent. Headers that net/http writes itself, such as Content-Length and
+// Accept-Encoding, are not in the request passed to Sign.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// WithSigner - Sign every request with signer. An error from Sign fails the request.
+func WithSigner(signer Signer) Option {
+	return func(o *options) {
+		o.signer = signer
+	}
+}
+
+// HMACSigner - A reference Signer using HMAC-SHA256. Sign sets the X-Date header to the
+// current UTC time (RFC 3339) and the Authorization header to:
+//
+//	HMAC-SHA256 KeyID=<KeyID>,Signature=<base64 HMAC-SHA256(Key, string to sign)>
+//
+// The string to sign is the following, joined by newlines: method, host, request URI (path and
+// query), X-Date, and the hex SHA-256 of the request body (of no bytes when there is no body).
+type HMACSigner struct {
+	KeyID string
+	Key   []byte
+}
+
+// Sign - Sign req; see HMACSigner.
+func (s *HMACSigner) Sign(req *http.Request) error {
+	date := time.Now().UTC().Format(time.RFC3339)
+	req.Header.Set("X-Date", date)
+	toSign, err := hmacStringToSign(req)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 KeyID=%s,Signature=%s",
+		s.KeyID, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return nil
+}
+
+// hmacStringToSign - Build the HMACSigner string to sign. The body is read using GetBody, so
+// req.Body is not consumed.
+func hmacStringToSign(req *http.Request) (string, error) {
+	h := sha256.New()
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return strings.Join([]string{req.Method, host, req.URL.RequestURI(), req.Header.Get("X-Date"),
+		hex.EncodeToString(h.Sum(nil))}, "\n"), nil
+}
+
+// signerTransport - An http.RoundTripper that signs each request with signer.
+type signerTransport struct {
+	rt     http.RoundTripper
+	signer Signer
+}
+
+func (t *signerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request.
+	r := req.Clone(req.Context())
+	if err := t.signer.Sign(r); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("signing request: %w", err)
+	}
+	return t.rt.RoundTrip(r)
+}
+
+// CloseIdleConnections - Forward to the wrapped RoundTripper, so http.Client.CloseIdleConnections works.
+func (t *signerTransport) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,71 @@
+package httph
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type errSigner struct{}
+
+func (errSigner) Sign(req *http.Request) error {
+	return errors.New("no credentials")
+}
+
+func TestCollectURLSigner(t *testing.T) {
+	key := []byte("secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		toSign := strings.Join([]string{r.Method, r.Host, r.URL.RequestURI(), r.Header.Get("X-Date"),
+			hex.EncodeToString(sum[:])}, "\n")
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(toSign))
+		expected := fmt.Sprintf("HMAC-SHA256 KeyID=id1,Signature=%s", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		if r.Header.Get("Authorization") != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	signer := &HMACSigner{KeyID: "id1", Key: key}
+	value, resp, err := CollectURL(server.URL+"/path?q=1", 1*time.Second, http.MethodGet, WithSigner(signer))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected StatusOK, got %v, error: %v", resp, err)
+	}
+
+	getBody := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader([]byte("data"))), nil }
+	value, resp, err = CollectURL(server.URL, 1*time.Second, http.MethodPost, WithSigner(signer), WithBody(getBody, 4),
+		WithOutgoingHeaderAllowlist([]string{"Authorization", "X-Date"}))
+	if err != nil || resp.StatusCode != http.StatusOK || string(value) != "data" {
+		t.Errorf("Expected StatusOK and data, got %v, %s, error: %v", resp, value, err)
+	}
+
+	// Signing headers that are not allowed are not sent.
+	_, resp, _ = CollectURL(server.URL, 1*time.Second, http.MethodGet, WithSigner(signer), WithOutgoingHeaderAllowlist(nil))
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected StatusUnauthorized, got %v", resp)
+	}
+
+	_, resp, _ = CollectURL(server.URL, 1*time.Second, http.MethodGet, WithSigner(&HMACSigner{KeyID: "id1", Key: []byte("wrong")}))
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected StatusUnauthorized, got %v", resp)
+	}
+
+	if _, _, err = CollectURL(server.URL, 1*time.Second, http.MethodGet, WithSigner(errSigner{})); err == nil ||
+		!strings.Contains(err.Error(), "no credentials") {
+		t.Errorf("Expected signing error, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package httph
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/paulfdunn/logh"
+)
+
+var (
+	// ErrUnexpectedStatus is returned by CollectURLSSE when the response status is not 2xx.
+	ErrUnexpectedStatus = errors.New("unexpected status")
+	// ErrMaxEventSize is returned by CollectURLSSE when a line or event is larger than
+	// maxEventSize.
+	ErrMaxEventSize = errors.New("event exceeds max size")
+)
+
+const (
+	// maxEventSize is the max size of a line, and of the data of an event, for CollectURLSSE.
+	maxEventSize = 1 << 20
+)
+
+// CollectURLSSE - Make a MethodGet request to urlIn and call handler with each event of the
+// response as it arrives, until the stream ends (nil is returned), handler returns an error
+// (which is returned), or ctx is done. There is no request timeout; use ctx to bound the stream.
+// When the response Content-Type is text/event-stream the body is parsed as server-sent events,
+// and handler is called with the data of each event (multiple data lines are joined with "\n");
+// otherwise, such as newline delimited JSON, handler is called with each non-empty line.
+// An event that is not ended by a blank line when the stream ends is incomplete, and discarded.
+// A line or event larger than 1MiB returns ErrMaxEventSize; WithMaxBodySize limits the whole
+// stream.
+func CollectURLSSE(ctx context.Context, urlIn string, handler func(event string) error, opts ...Option) error {
+	o := newOptions(opts)
+	if o.verifyContentDigest {
+		// Events are handled before the end of the body, so the body can not be verified first.
+		return fmt.Errorf("%w: not supported by CollectURLSSE", ErrContentDigest)
+	}
+	o.header = o.header.Clone()
+	if o.header == nil {
+		o.header = http.Header{}
+	}
+	o.header.Set("Accept", "text/event-stream, application/x-ndjson;q=0.9, */*;q=0.8")
+	client := newClient(0, false, o)
+	defer client.CloseIdleConnections()
+
+	req, err := newRequest(ctx, urlIn, http.MethodGet, o)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logh.Map[appName].Printf(logh.Warning, "CollectURLSSE client error:%v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	sse := false
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		sse = mediaType == "text/event-stream"
+	}
+	br := bufio.NewReader(o.limitBody(resp.Body))
+	var data []string
+	dataSize := 0
+	for {
+		line, err := readLine(br, maxEventSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		line = strings.TrimRight(line, "\r\n")
+
+		var event *string
+		switch {
+		case !sse:
+			if line != "" {
+				event = &line
+			}
+		case eof:
+			// An event without a blank line at the end of the stream is incomplete.
+		case line == "":
+			// A blank line dispatches the event.
+			if len(data) > 0 {
+				e := strings.Join(data, "\n")
+				event = &e
+				data, dataSize = nil, 0
+			}
+		default:
+			data = appendSSEData(data, line)
+			if dataSize += len(line); dataSize > maxEventSize {
+				return fmt.Errorf("%w: more than %d bytes", ErrMaxEventSize, maxEventSize)
+			}
+		}
+		if event != nil {
+			if err := handler(*event); err != nil {
+				return err
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// readLine - Read a line, including the newline, of at most max bytes; a longer line returns
+// ErrMaxEventSize without buffering the rest of it.
+func readLine(br *bufio.Reader, max int) (string, error) {
+	var line []byte
+	for {
+		frag, err := br.ReadSlice('\n')
+		if len(line)+len(frag) > max {
+			return "", fmt.Errorf("%w: line longer than %d bytes", ErrMaxEventSize, max)
+		}
+		line = append(line, frag...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// appendSSEData - If line is a server-sent event data field, append its value to data. Other
+// fields (event, id, retry) and comments are ignored.
+func appendSSEData(data []string, line string) []string {
+	field, value, _ := strings.Cut(line, ":")
+	if field != "data" {
+		return data
+	}
+	return append(data, strings.TrimPrefix(value, " "))
+}
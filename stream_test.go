@@ -0,0 +1,88 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollectURLSSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, e := range []string{": comment\n", "event: a\ndata: one\n\n", "data: two\ndata: lines\n\n", "data: three"} {
+				w.Write([]byte(e))
+				w.(http.Flusher).Flush()
+			}
+		case "/ndjson":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Write([]byte("{\"a\":1}\n\n{\"b\":2}\r\n"))
+		case "/long":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: " + strings.Repeat("a", 2*maxEventSize)))
+		case "/longevent":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				w.Write([]byte("data: " + strings.Repeat("a", maxEventSize/2) + "\n"))
+			}
+			w.Write([]byte("\n"))
+		case "/block":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: one\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var events []string
+	handler := func(event string) error {
+		events = append(events, event)
+		return nil
+	}
+	if err := CollectURLSSE(context.Background(), server.URL+"/sse", handler); err != nil {
+		t.Errorf("CollectURLSSE returned non-nil error: %v", err)
+	}
+	// The unterminated last event is discarded.
+	if expected := []string{"one", "two\nlines"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %q, got %q", expected, events)
+	}
+
+	events = nil
+	if err := CollectURLSSE(context.Background(), server.URL+"/ndjson", handler); err != nil {
+		t.Errorf("CollectURLSSE returned non-nil error: %v", err)
+	}
+	if expected := []string{`{"a":1}`, `{"b":2}`}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %q, got %q", expected, events)
+	}
+
+	// Cancelling from the handler ends a stream that does not end on its own.
+	ctx, cancel := context.WithCancel(context.Background())
+	err := CollectURLSSE(ctx, server.URL+"/block", func(event string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	for _, path := range []string{"/long", "/longevent"} {
+		if err := CollectURLSSE(context.Background(), server.URL+path, handler); !errors.Is(err, ErrMaxEventSize) {
+			t.Errorf("Expected ErrMaxEventSize for %s, got %v", path, err)
+		}
+	}
+	if err := CollectURLSSE(context.Background(), server.URL+"/sse", handler, WithMaxBodySize(20)); !errors.Is(err, ErrMaxBodySize) {
+		t.Errorf("Expected ErrMaxBodySize, got %v", err)
+	}
+
+	if err := CollectURLSSE(context.Background(), server.URL+"/missing", handler); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Errorf("Expected ErrUnexpectedStatus, got %v", err)
+	}
+}
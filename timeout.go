@@ -0,0 +1,128 @@
+package httph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxTimeoutJitter is the max WithTimeoutJitter fraction, which keeps jittered timeouts well
+	// above zero; a zero http.Client.Timeout is no timeout.
+	maxTimeoutJitter = 0.5
+)
+
+var (
+	// ErrMaxBodyReadDuration is returned when reading a body takes longer than allowed by
+	// WithMaxBodyReadDuration.
+	ErrMaxBodyReadDuration = errors.New("body read exceeded max duration")
+	// ErrFirstByteTimeout is returned when the first body byte is not read within the timeout
+	// set by WithFirstByteTimeout.
+	ErrFirstByteTimeout = errors.New("first body byte timeout")
+)
+
+// WithMaxBodyReadDuration - Bound the time spent reading a response body, measured from when
+// the first body byte is read, independent of the time to connect and receive headers.
+// If the body has not been read completely after max, the request is cancelled and
+// ErrMaxBodyReadDuration is returned.
+func WithMaxBodyReadDuration(max time.Duration) Option {
+	return func(o *options) {
+		o.maxBodyReadDuration = max
+	}
+}
+
+// WithFirstByteTimeout - Bound the time from when the response headers are received until the
+// first body byte is read, independent of the time to connect and receive headers. The time
+// includes any time spent in WithOnStatus, or waiting for WithMemoryBudget, before the body is
+// read. If no body byte has been read after timeout, the request is cancelled and
+// ErrFirstByteTimeout is returned.
+func WithFirstByteTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.firstByteTimeout = timeout
+	}
+}
+
+// WithTimeoutJitter - Randomly change the timeout of each request by up to +/- fraction of the
+// timeout, so that requests with the same timeout to a stalled host do not all time out at once.
+// For example 0.1 gives a timeout of 9 to 11 seconds for a 10 second timeout. fraction is limited
+// to maxTimeoutJitter; fraction <= 0 disables (default).
+func WithTimeoutJitter(fraction float64) Option {
+	return func(o *options) {
+		if fraction > maxTimeoutJitter {
+			fraction = maxTimeoutJitter
+		}
+		o.timeoutJitter = fraction
+	}
+}
+
+// jitter - Return timeout changed by a random amount up to +/- fraction of timeout.
+func jitter(timeout time.Duration, fraction float64) time.Duration {
+	return timeout + time.Duration((2*rand.Float64()-1)*fraction*float64(timeout))
+}
+
+// timedBodyReader - An io.Reader that calls cancel, and returns an error, if reading takes too
+// long.
+type timedBodyReader struct {
+	r                io.Reader
+	cancel           context.CancelFunc
+	firstByteTimeout time.Duration
+	max              time.Duration
+	firstByteTimer   *time.Timer
+	timer            *time.Timer
+	// expired is the error to return after cancel was called by a timer.
+	expired atomic.Value
+}
+
+// newTimedBodyReader - Wrap r, per the options; cancel must cancel the request. Must be called
+// when the response headers are received, as the first byte timeout starts. Returns r if no
+// body timing options are set. The returned stop func must be called when done reading.
+func newTimedBodyReader(r io.Reader, cancel context.CancelFunc, o *options) (io.Reader, func()) {
+	if o.maxBodyReadDuration <= 0 && o.firstByteTimeout <= 0 {
+		return r, func() {}
+	}
+	tbr := &timedBodyReader{r: r, cancel: cancel, firstByteTimeout: o.firstByteTimeout, max: o.maxBodyReadDuration}
+	if tbr.firstByteTimeout > 0 {
+		tbr.firstByteTimer = tbr.afterFunc(tbr.firstByteTimeout,
+			fmt.Errorf("%w: %v", ErrFirstByteTimeout, tbr.firstByteTimeout))
+	}
+	return tbr, func() {
+		if tbr.firstByteTimer != nil {
+			tbr.firstByteTimer.Stop()
+		}
+		if tbr.timer != nil {
+			tbr.timer.Stop()
+		}
+	}
+}
+
+func (tbr *timedBodyReader) Read(p []byte) (int, error) {
+	// The request may have been cancelled before a Read, while the body was already buffered.
+	if expired, ok := tbr.expired.Load().(error); ok {
+		return 0, expired
+	}
+	n, err := tbr.r.Read(p)
+	if (n > 0 || err != nil) && tbr.firstByteTimer != nil {
+		tbr.firstByteTimer.Stop()
+	}
+	if n > 0 && tbr.timer == nil && tbr.max > 0 {
+		tbr.timer = tbr.afterFunc(tbr.max, fmt.Errorf("%w: %v", ErrMaxBodyReadDuration, tbr.max))
+	}
+	if err != nil && err != io.EOF {
+		if expired, ok := tbr.expired.Load().(error); ok {
+			err = expired
+		}
+	}
+	return n, err
+}
+
+// afterFunc - Cancel the request after d, recording err as the error to return.
+func (tbr *timedBodyReader) afterFunc(d time.Duration, err error) *time.Timer {
+	return time.AfterFunc(d, func() {
+		tbr.expired.CompareAndSwap(nil, err)
+		tbr.cancel()
+	})
+}
@@ -0,0 +1,120 @@
+package httph
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLMaxBodyReadDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slowheaders" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			if r.URL.Path == "/slowbody" {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+
+	// Time before the first body byte is not counted.
+	value, _, err := CollectURL(server.URL+"/slowheaders", 5*time.Second, http.MethodGet, WithMaxBodyReadDuration(50*time.Millisecond))
+	if err != nil || string(value) != "chunkchunkchunk" {
+		t.Errorf("Expected chunkchunkchunk, got %s, error: %v", value, err)
+	}
+
+	_, _, err = CollectURL(server.URL+"/slowbody", 5*time.Second, http.MethodGet, WithMaxBodyReadDuration(50*time.Millisecond))
+	if !errors.Is(err, ErrMaxBodyReadDuration) {
+		t.Errorf("Expected ErrMaxBodyReadDuration, got %v", err)
+	}
+}
+
+func TestCollectURLFirstByteTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/stall" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	// Time after the first body byte is not counted.
+	value, _, err := CollectURL(server.URL, 5*time.Second, http.MethodGet, WithFirstByteTimeout(100*time.Millisecond))
+	if err != nil || string(value) != "chunkchunkchunk" {
+		t.Errorf("Expected chunkchunkchunk, got %s, error: %v", value, err)
+	}
+
+	_, _, err = CollectURL(server.URL+"/stall", 5*time.Second, http.MethodGet, WithFirstByteTimeout(100*time.Millisecond),
+		WithMaxBodyReadDuration(time.Second))
+	if !errors.Is(err, ErrFirstByteTimeout) {
+		t.Errorf("Expected ErrFirstByteTimeout, got %v", err)
+	}
+}
+
+func TestCollectURLsTimeoutJitter(t *testing.T) {
+	min, max := time.Hour, time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		d := jitter(10*time.Second, 0.1)
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	if min < 9*time.Second || max > 11*time.Second || max-min < time.Second {
+		t.Errorf("Unexpected jitter range, min:%v, max:%v", min, max)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// fraction is limited, so the timeout is never less than 100ms, or 0 (no timeout).
+	urls := []string{server.URL, server.URL + "/slow", server.URL + "/slow"}
+	start := time.Now()
+	ucds := CollectURLs(urls, 200*time.Millisecond, http.MethodGet, 3, WithTimeoutJitter(5))
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected timeouts within 300ms, took %v", elapsed)
+	}
+	for _, ucd := range ucds {
+		if slow := ucd.URL != server.URL; slow != (ucd.Err != nil) {
+			t.Errorf("Unexpected result for %s, error: %v", ucd.URL, ucd.Err)
+		}
+	}
+}
+
+func TestCollectURLFirstByteTimeoutOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The timeout starts when the headers are received, so time in WithOnStatus is counted.
+	onStatus := func(url string, resp *http.Response) bool {
+		time.Sleep(200 * time.Millisecond)
+		return true
+	}
+	_, _, err := CollectURL(server.URL, 5*time.Second, http.MethodGet, WithFirstByteTimeout(100*time.Millisecond),
+		WithOnStatus(onStatus))
+	if !errors.Is(err, ErrFirstByteTimeout) {
+		t.Errorf("Expected ErrFirstByteTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package httph
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// WithRootCAs - By default TLS certificates are not verified. WithRootCAs enables verification
+// of the certificate chain and host name, using roots as the trusted root certificates.
+func WithRootCAs(roots *x509.CertPool) Option {
+	return func(o *options) {
+		o.rootCAs = roots
+		o.verifyTLS = true
+	}
+}
+
+// WithAcceptInvalidHostnames - By default TLS certificates are not verified.
+// WithAcceptInvalidHostnames enables verification of the certificate chain, against the roots
+// from WithRootCAs or the system roots, for all hosts. The host name is also verified, except for
+// the URL hosts (without port) in hosts, which are accepted with any valid certificate. This is
+// intended for services that are reached by IP address or an internal name that is not in the
+// certificate, and is more secure than skipping verification.
+func WithAcceptInvalidHostnames(hosts []string) Option {
+	return func(o *options) {
+		o.acceptInvalidHostnames = map[string]bool{}
+		for _, h := range hosts {
+			o.acceptInvalidHostnames[h] = true
+		}
+		o.verifyTLS = true
+	}
+}
+
+// verifyConnection - Return a tls.Config.VerifyConnection that verifies the certificate chain
+// against roots, and the certificate host name against dnsName; an empty dnsName skips the
+// host name check.
+func verifyConnection(roots *x509.CertPool, dnsName string) func(cs tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificates")
+		}
+		opts := x509.VerifyOptions{Roots: roots, DNSName: dnsName, Intermediates: x509.NewCertPool()}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
@@ -0,0 +1,41 @@
+package httph
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLAcceptInvalidHostnames(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	// The test certificate is valid for 127.0.0.1 and example.com, but not localhost.
+	localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		url  string
+		opts []Option
+		ok   bool
+	}{
+		{localhost, nil, true},
+		{server.URL, []Option{WithRootCAs(roots)}, true},
+		{localhost, []Option{WithRootCAs(roots)}, false},
+		{localhost, []Option{WithRootCAs(roots), WithAcceptInvalidHostnames([]string{"localhost"})}, true},
+		{server.URL, []Option{WithRootCAs(roots), WithAcceptInvalidHostnames([]string{"localhost"})}, true},
+		// The chain is still verified.
+		{localhost, []Option{WithAcceptInvalidHostnames([]string{"localhost"})}, false},
+	}
+	for i, test := range tests {
+		_, _, err := CollectURL(test.url, 1*time.Second, http.MethodGet, test.opts...)
+		if (err == nil) != test.ok {
+			t.Errorf("test %d expected ok %t, got error: %v", i, test.ok, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package httph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulfdunn/logh"
+)
+
+// safeFileChars matches the characters allowed in the host directory and file extension.
+var safeFileChars = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// CollectURLsToDir - Pass in a slice of URLs, a base directory, request timeout, and threads
+// number of parallel requests, and the body of a MethodGet request to each URL is streamed to a
+// file under baseDir, rather than buffered in memory. The body is written exactly as sent by the
+// server. Each file path is baseDir/host/shard/hash[.ext], where hash is the SHA-256 of the URL,
+// shard is the first 2 characters of hash, and ext is the extension of the URL path, if short and
+// safe; so paths have a bounded length regardless of the URL, and directories do not grow too
+// large. If a URL is repeated in urls, "-n" is added to the hash of the nth repeat.
+// Each result has FilePath, FileSize, and Response set; Bytes is not set.
+func CollectURLsToDir(urls []string, baseDir string, timeout time.Duration, threads int, opts ...Option) []URLCollectionData {
+	o := newOptions(opts)
+	client := newClient(timeout, true, o)
+
+	var mu sync.Mutex
+	paths := map[string][]string{}
+	for _, u := range urls {
+		p := urlFilePath(baseDir, u)
+		if n := len(paths[u]); n > 0 {
+			ext := filepath.Ext(p)
+			p = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(p, ext), n, ext)
+		}
+		paths[u] = append(paths[u], p)
+	}
+
+	return collectURLs(urls, threads, o, client, func(u string) URLCollectionData {
+		// Each repeat of a URL takes the next unused path.
+		mu.Lock()
+		filePath := paths[u][0]
+		paths[u] = paths[u][1:]
+		mu.Unlock()
+
+		ucd := URLCollectionData{URL: u, FilePath: filePath}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			logh.Map[appName].Printf(logh.Error, "CollectURLsToDir error creating directory:%v", err)
+			ucd.Err = err
+			return ucd
+		}
+		ucd.FileSize, ucd.Response, ucd.Err = collectURLToFile(context.Background(), client, u, filePath, &ucd.StartedAt, o)
+		if !ucd.StartedAt.IsZero() {
+			ucd.CompletedAt = time.Now()
+		}
+		return ucd
+	})
+}
+
+// urlFilePath - Return the file path for urlIn; see CollectURLsToDir.
+func urlFilePath(baseDir string, urlIn string) string {
+	sum := sha256.Sum256([]byte(urlIn))
+	hash := hex.EncodeToString(sum[:])
+
+	host := "_invalid"
+	ext := ""
+	if u, err := url.Parse(urlIn); err == nil {
+		if h := strings.ReplaceAll(u.Host, ":", "_"); safeFileChars.MatchString(h) && !strings.HasPrefix(h, ".") {
+			host = h
+		}
+		if e := path.Ext(u.Path); len(e) <= 16 && safeFileChars.MatchString(e) {
+			ext = e
+		}
+	}
+	return filepath.Join(baseDir, host, hash[:2], hash+ext)
+}
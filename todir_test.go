@@ -0,0 +1,50 @@
+package httph
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectURLsToDir(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	long := "/" + strings.Repeat("a", 1000) + ".html"
+	urls := []string{server.URL + "/a.txt", server.URL + long, server.URL + "/a.txt"}
+	ucds := CollectURLsToDir(urls, dir, 1*time.Second, 2)
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+		return
+	}
+	paths := map[string]bool{}
+	for _, ucd := range ucds {
+		if ucd.Err != nil {
+			t.Errorf("CollectURLsToDir returned non-nil error: %v", ucd.Err)
+			continue
+		}
+		paths[ucd.FilePath] = true
+		path := strings.TrimPrefix(ucd.URL, server.URL)
+		b, err := os.ReadFile(ucd.FilePath)
+		if err != nil || string(b) != path || ucd.FileSize != int64(len(path)) || ucd.Bytes != nil {
+			t.Errorf("File %s does not match, got %d bytes, error: %v", ucd.FilePath, ucd.FileSize, err)
+		}
+		if ucd.Response.StatusCode != http.StatusOK {
+			t.Errorf("incorrect status, expected %d, got %d", http.StatusOK, ucd.Response.StatusCode)
+		}
+		if rel, _ := filepath.Rel(dir, ucd.FilePath); len(rel) > 100 || filepath.Ext(rel) != filepath.Ext(path) {
+			t.Errorf("Unexpected file path %s", rel)
+		}
+	}
+	if len(paths) != len(urls) {
+		t.Errorf("Expected %d unique paths, got %d", len(urls), len(paths))
+	}
+}
@@ -0,0 +1,85 @@
+package httph
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnEventType - The type of a ConnEvent.
+type ConnEventType string
+
+const (
+	// ConnEventConnectStart - A new connection is being dialed.
+	ConnEventConnectStart ConnEventType = "connect_start"
+	// ConnEventConnectDone - Dialing a new connection completed; Err is set on failure.
+	ConnEventConnectDone ConnEventType = "connect_done"
+	// ConnEventGotConn - A connection was obtained for the request; Reused, WasIdle, and
+	// IdleTime describe whether it came from the idle pool.
+	ConnEventGotConn ConnEventType = "got_conn"
+	// ConnEventPutIdleConn - The connection was returned to the idle pool; if Err is set
+	// the connection was closed instead.
+	ConnEventPutIdleConn ConnEventType = "put_idle_conn"
+)
+
+// ConnEvent - A connection event recorded by WithConnectionTrace.
+type ConnEvent struct {
+	Time     time.Time
+	Type     ConnEventType
+	Addr     string
+	Reused   bool
+	WasIdle  bool
+	IdleTime time.Duration
+	Err      error
+}
+
+// WithConnectionTrace - Record the connection events (connect, reuse, return to the idle pool,
+// close) of each request in URLCollectionData.ConnEvents. Useful to verify connections are
+// being reused when keep-alive is enabled with WithIdleConnTimeout.
+func WithConnectionTrace() Option {
+	return func(o *options) {
+		o.connectionTrace = true
+	}
+}
+
+// connTracer - Records ConnEvents from httptrace callbacks, which may be called concurrently.
+type connTracer struct {
+	mu     sync.Mutex
+	events []ConnEvent
+}
+
+func (ct *connTracer) add(e ConnEvent) {
+	e.Time = time.Now()
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.events = append(ct.events, e)
+}
+
+// Events - Return a copy of the recorded events.
+func (ct *connTracer) Events() []ConnEvent {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return append([]ConnEvent{}, ct.events...)
+}
+
+// withClientTrace - Return a context that records events to ct.
+func (ct *connTracer) withClientTrace(ctx context.Context) context.Context {
+	var addr string
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		ConnectStart: func(network, a string) {
+			ct.add(ConnEvent{Type: ConnEventConnectStart, Addr: a})
+		},
+		ConnectDone: func(network, a string, err error) {
+			ct.add(ConnEvent{Type: ConnEventConnectDone, Addr: a, Err: err})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			addr = info.Conn.RemoteAddr().String()
+			ct.add(ConnEvent{Type: ConnEventGotConn, Addr: addr, Reused: info.Reused,
+				WasIdle: info.WasIdle, IdleTime: info.IdleTime})
+		},
+		PutIdleConn: func(err error) {
+			ct.add(ConnEvent{Type: ConnEventPutIdleConn, Addr: addr, Err: err})
+		},
+	})
+}
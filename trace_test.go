@@ -0,0 +1,42 @@
+package httph
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLsConnectionTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL, server.URL}
+	ucds := CollectURLs(urls, 1*time.Second, http.MethodGet, 1, WithConnectionTrace(), WithIdleConnTimeout(time.Second))
+	if len(ucds) != len(urls) {
+		t.Errorf("Incorrect number of URLCollectionData items returned, expected %d, got %d", len(urls), len(ucds))
+		return
+	}
+	// The first request dials a connection, the second reuses it.
+	for i, ucd := range ucds {
+		var gotConn *ConnEvent
+		connects := 0
+		for j, e := range ucd.ConnEvents {
+			switch e.Type {
+			case ConnEventConnectStart:
+				connects++
+			case ConnEventGotConn:
+				gotConn = &ucd.ConnEvents[j]
+			}
+		}
+		if gotConn == nil {
+			t.Errorf("Expected a %s event, got %+v", ConnEventGotConn, ucd.ConnEvents)
+			continue
+		}
+		if reused := i == 1; gotConn.Reused != reused || (connects == 0) != reused {
+			t.Errorf("Request %d expected reused %t, got %+v", i, reused, ucd.ConnEvents)
+		}
+	}
+}
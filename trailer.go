@@ -0,0 +1,69 @@
+package httph
+
+import (
+	"io"
+	"net/http"
+)
+
+// WithRequestTrailer - Send trailers after the body of MethodPost and MethodPut requests. keys
+// are the trailer names, announced in the Trailer header; values is called after the body has
+// been sent, so the values can depend on the body, such as a checksum, and only values for keys
+// are sent. Trailers require chunked transfer encoding, so the body is sent chunked.
+func WithRequestTrailer(keys []string, values func() http.Header) Option {
+	return func(o *options) {
+		o.requestTrailerKeys = keys
+		o.requestTrailer = values
+	}
+}
+
+// trailerTransport - An http.RoundTripper that adds trailers to requests with a body. It must
+// wrap the http.Transport directly, as it sets the trailer values on the request it sends once
+// the body has been read; a RoundTripper below it that copied the request would send the copy,
+// without the values.
+type trailerTransport struct {
+	rt     http.RoundTripper
+	keys   []string
+	values func() http.Header
+}
+
+func (t *trailerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.rt.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request.
+	r := req.Clone(req.Context())
+	r.Trailer = http.Header{}
+	for _, k := range t.keys {
+		r.Trailer[http.CanonicalHeaderKey(k)] = nil
+	}
+	r.ContentLength = -1
+	r.Body = &trailerBody{ReadCloser: req.Body, onEOF: func() {
+		values := t.values()
+		for k := range r.Trailer {
+			r.Trailer[k] = values[k]
+		}
+	}}
+	return t.rt.RoundTrip(r)
+}
+
+// CloseIdleConnections - Forward to the wrapped RoundTripper, so http.Client.CloseIdleConnections works.
+func (t *trailerTransport) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// trailerBody - A request body that calls onEOF once, when the body has been read.
+type trailerBody struct {
+	io.ReadCloser
+	onEOF func()
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF && b.onEOF != nil {
+		b.onEOF()
+		b.onEOF = nil
+	}
+	return n, err
+}
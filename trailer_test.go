@@ -0,0 +1,51 @@
+package httph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLRequestTrailer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// Trailers are available after the body is read.
+		w.Write([]byte(string(body) + " " + r.Trailer.Get("X-Checksum") + " " + r.Trailer.Get("X-Other")))
+	}))
+	defer server.Close()
+
+	data := []byte("data")
+	hash := sha256.New()
+	getBody := func() (io.ReadCloser, error) {
+		hash.Reset()
+		return io.NopCloser(io.TeeReader(bytes.NewReader(data), hash)), nil
+	}
+	values := func() http.Header {
+		return http.Header{"X-Checksum": {hex.EncodeToString(hash.Sum(nil))}, "X-Other": {"not sent"}}
+	}
+	sum := sha256.Sum256(data)
+	expected := "data " + hex.EncodeToString(sum[:]) + " "
+	value, _, err := CollectURL(server.URL, 1*time.Second, http.MethodPost, WithBody(getBody, int64(len(data))),
+		WithRequestTrailer([]string{"x-checksum"}, values))
+	if err != nil || string(value) != expected {
+		t.Errorf("Expected %s, got %s, error: %v", expected, value, err)
+	}
+
+	// Other RoundTrippers wrap trailerTransport, so the trailer values are still sent.
+	value, _, err = CollectURL(server.URL, 1*time.Second, http.MethodPost, WithBody(getBody, int64(len(data))),
+		WithRequestTrailer([]string{"x-checksum"}, values), WithReadDeadlinePerChunk(1*time.Second))
+	if err != nil || string(value) != expected {
+		t.Errorf("Expected %s, got %s, error: %v", expected, value, err)
+	}
+
+	// Requests without a body are unchanged.
+	value, _, err = CollectURL(server.URL, 1*time.Second, http.MethodGet, WithRequestTrailer([]string{"x-checksum"}, values))
+	if err != nil || string(value) != "  " {
+		t.Errorf("Expected no trailers, got %s, error: %v", value, err)
+	}
+}
@@ -0,0 +1,164 @@
+package httph
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// BodyTransform - A BodyTransform wraps the response body reader r, returning a reader that
+// transforms the body. resp is provided for access to headers; resp.Body must not be read.
+type BodyTransform func(resp *http.Response, r io.Reader) (io.Reader, error)
+
+var (
+	// ErrUnsupportedCharset is returned by CharsetToUTF8Transform for a charset it can not decode.
+	ErrUnsupportedCharset = errors.New("unsupported charset")
+)
+
+// WithBodyPipeline - Apply transforms, in order, to each response body before it is read. For
+// example: []BodyTransform{GunzipTransform, CharsetToUTF8Transform, StripBOMTransform}.
+// WithExpectedContentLength is checked against the body before transformation.
+func WithBodyPipeline(transforms []BodyTransform) Option {
+	return func(o *options) {
+		o.bodyPipeline = transforms
+	}
+}
+
+// GunzipTransform - Decompress bodies that are gzip data. The body is identified as gzip by its
+// leading magic bytes, not by headers, so both a gzip file and a Content-Encoding: gzip body that
+// was not decompressed by the transport are decompressed. Other bodies are unchanged.
+func GunzipTransform(resp *http.Response, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// CharsetToUTF8Transform - Convert the body from the charset specified in the Content-Type header
+// to UTF-8. Supported charsets are: utf-8, us-ascii, iso-8859-1 (latin1), windows-1252,
+// utf-16, utf-16le, and utf-16be. Bodies with no charset are unchanged. Any other charset returns
+// ErrUnsupportedCharset.
+func CharsetToUTF8Transform(resp *http.Response, r io.Reader) (io.Reader, error) {
+	charset := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		charset = strings.ToLower(params["charset"])
+	}
+
+	br := bufio.NewReader(r)
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii":
+		return br, nil
+	case "iso-8859-1", "latin1":
+		return &decodeReader{src: br, next: decodeLatin1}, nil
+	case "windows-1252", "cp1252":
+		return &decodeReader{src: br, next: decodeWindows1252}, nil
+	case "utf-16", "utf-16be":
+		order := binary.ByteOrder(binary.BigEndian)
+		if charset == "utf-16" {
+			// A BOM specifies the byte order; the default is big endian (RFC 2781).
+			if bom, err := br.Peek(2); err == nil {
+				switch {
+				case bom[0] == 0xfe && bom[1] == 0xff:
+					br.Discard(2)
+				case bom[0] == 0xff && bom[1] == 0xfe:
+					br.Discard(2)
+					order = binary.LittleEndian
+				}
+			}
+		}
+		return &decodeReader{src: br, next: decodeUTF16(order)}, nil
+	case "utf-16le":
+		return &decodeReader{src: br, next: decodeUTF16(binary.LittleEndian)}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedCharset, charset)
+}
+
+// StripBOMTransform - Remove a leading UTF-8 byte order mark from the body.
+func StripBOMTransform(resp *http.Response, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xef, 0xbb, 0xbf}) {
+		br.Discard(3)
+	}
+	return br, nil
+}
+
+// applyBodyPipeline - Apply the transforms to r, in order.
+func applyBodyPipeline(transforms []BodyTransform, resp *http.Response, r io.Reader) (io.Reader, error) {
+	for _, transform := range transforms {
+		var err error
+		if r, err = transform(resp, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// decodeReader - An io.Reader that decodes src, one rune at a time using next, to UTF-8.
+type decodeReader struct {
+	src     *bufio.Reader
+	next    func(*bufio.Reader) (rune, error)
+	pending []byte
+	err     error
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	for d.err == nil && len(d.pending) < len(p) {
+		var r rune
+		if r, d.err = d.next(d.src); d.err == nil {
+			d.pending = utf8.AppendRune(d.pending, r)
+		}
+	}
+	if len(d.pending) == 0 {
+		return 0, d.err
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func decodeLatin1(br *bufio.Reader) (rune, error) {
+	b, err := br.ReadByte()
+	return rune(b), err
+}
+
+// windows1252 - The code points for bytes 0x80-0x9f; the other bytes match iso-8859-1.
+var windows1252 = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(br *bufio.Reader) (rune, error) {
+	b, err := br.ReadByte()
+	if err == nil && b >= 0x80 && b <= 0x9f {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), err
+}
+
+func decodeUTF16(order binary.ByteOrder) func(*bufio.Reader) (rune, error) {
+	return func(br *bufio.Reader) (rune, error) {
+		var b [2]byte
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			return 0, err
+		}
+		r1 := rune(order.Uint16(b[:]))
+		if !utf16.IsSurrogate(r1) {
+			return r1, nil
+		}
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			return 0, err
+		}
+		return utf16.DecodeRune(r1, rune(order.Uint16(b[:]))), nil
+	}
+}
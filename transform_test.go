@@ -0,0 +1,55 @@
+package httph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectURLBodyPipeline(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	// UTF-16LE with a BOM: "h€y"
+	zw.Write([]byte{0xff, 0xfe, 'h', 0, 0xac, 0x20, 'y', 0})
+	zw.Close()
+	bodies := map[string][]byte{
+		"/gzip":         gz.Bytes(),
+		"/windows-1252": {'h', 0x80, 'y'},
+		"/utf-8":        {0xef, 0xbb, 0xbf, 'h', 0xe2, 0x82, 0xac, 'y'},
+		"/ebcdic":       {'h', 'y'},
+	}
+	charsets := map[string]string{
+		"/gzip":         "utf-16",
+		"/windows-1252": "windows-1252",
+		"/utf-8":        "utf-8",
+		"/ebcdic":       "ebcdic",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset="+charsets[r.URL.Path])
+		w.WriteHeader(http.StatusOK)
+		w.Write(bodies[r.URL.Path])
+	}))
+	defer server.Close()
+
+	pipeline := WithBodyPipeline([]BodyTransform{GunzipTransform, CharsetToUTF8Transform, StripBOMTransform})
+	for _, path := range []string{"/gzip", "/windows-1252", "/utf-8"} {
+		value, _, err := CollectURL(server.URL+path, 1*time.Second, http.MethodGet, pipeline,
+			WithExpectedContentLength(int64(len(bodies[path]))))
+		if err != nil {
+			t.Errorf("CollectURL returned non-nil error: %v", err)
+			continue
+		}
+		if string(value) != "h€y" {
+			t.Errorf("path %s, expected h€y, got %q", path, value)
+		}
+	}
+
+	_, _, err := CollectURL(server.URL+"/ebcdic", 1*time.Second, http.MethodGet, pipeline)
+	if !errors.Is(err, ErrUnsupportedCharset) {
+		t.Errorf("Expected ErrUnsupportedCharset, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package httph
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var (
+	// ErrInvalidURL is returned for a URL that can not be parsed, is not absolute, or does not
+	// have an http or https scheme.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrURLTooLong is returned for a URL longer than allowed by WithMaxURLLength.
+	ErrURLTooLong = errors.New("URL exceeds max length")
+)
+
+const (
+	// DefaultMaxURLLength is the max URL length used when WithMaxURLLength is not set.
+	DefaultMaxURLLength = 16384
+	// urlErrorPrefixLength is the number of bytes of a too long URL included in the error.
+	urlErrorPrefixLength = 64
+)
+
+// WithMaxURLLength - Reject URLs longer than max bytes with ErrURLTooLong, without making a
+// request. The default is DefaultMaxURLLength; max <= 0 disables the check.
+func WithMaxURLLength(max int) Option {
+	return func(o *options) {
+		o.maxURLLength = max
+	}
+}
+
+// WithURLRewrite - Call rewrite with each URL, after it has been validated, and request the
+// returned URL instead, such as to send requests to a staging host. The rewritten URL is also
+// validated. URLCollectionData.URL, and anything else keyed by URL such as Collector.Cancel,
+// use the original URL. An error from rewrite fails the request.
+func WithURLRewrite(rewrite func(urlIn string) (string, error)) Option {
+	return func(o *options) {
+		o.urlRewrite = rewrite
+	}
+}
+
+// ValidateURLs - Run the checks done before each request on every URL in urls, including
+// WithURLRewrite and checking the rewritten URL, without making any network calls. The returned
+// URLCollectionData are in the same order as urls, with only URL and Err set; Err is nil for
+// valid URLs. Note this checks the form of a URL only; there is no check of the address a host
+// resolves to.
+func ValidateURLs(urls []string, opts ...Option) []URLCollectionData {
+	o := newOptions(opts)
+	ucds := make([]URLCollectionData, len(urls))
+	for i, u := range urls {
+		_, err := requestURL(u, o)
+		ucds[i] = URLCollectionData{URL: u, Err: err}
+	}
+	return ucds
+}
+
+// requestURL - Return the URL to request for urlIn: urlIn is validated, then rewritten per
+// WithURLRewrite, and the rewritten URL validated.
+func requestURL(urlIn string, o *options) (*url.URL, error) {
+	u, err := parseURL(urlIn, o)
+	if err != nil || o.urlRewrite == nil {
+		return u, err
+	}
+	rewritten, err := o.urlRewrite(urlIn)
+	if err != nil {
+		return nil, fmt.Errorf("rewriting url:%s, %w", urlIn, err)
+	}
+	return parseURL(rewritten, o)
+}
+
+// parseURL - Parse urlIn and check it is an absolute http or https URL, within the max length.
+func parseURL(urlIn string, o *options) (*url.URL, error) {
+	if o.maxURLLength > 0 && len(urlIn) > o.maxURLLength {
+		// Only a prefix of the URL is included, to keep logs sane.
+		prefix := urlIn
+		if len(prefix) > urlErrorPrefixLength {
+			prefix = prefix[:urlErrorPrefixLength]
+		}
+		return nil, fmt.Errorf("%w: length %d > %d, url prefix:%s", ErrURLTooLong, len(urlIn), o.maxURLLength, prefix)
+	}
+	u, err := url.Parse(urlIn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: unsupported scheme %q, url:%s", ErrInvalidURL, u.Scheme, urlIn)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: missing host, url:%s", ErrInvalidURL, urlIn)
+	}
+	return u, nil
+}
@@ -0,0 +1,95 @@
+package httph
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateURLs(t *testing.T) {
+	urls := []string{"http://example.com/a", "https://example.com:8443", "ftp://example.com",
+		"example.com/a", "http://", "http://[::1", "/relative"}
+	ucds := ValidateURLs(urls)
+	if len(ucds) != len(urls) {
+		t.Fatalf("Expected %d results, got %d", len(urls), len(ucds))
+	}
+	for i, ucd := range ucds {
+		valid := i < 2
+		if ucd.URL != urls[i] || valid != (ucd.Err == nil) || (!valid && !errors.Is(ucd.Err, ErrInvalidURL)) {
+			t.Errorf("Unexpected result for %s, error: %v", urls[i], ucd.Err)
+		}
+	}
+
+	// The same check is made before a request.
+	if _, _, err := CollectURL("ftp://127.0.0.1/", 1*time.Second, http.MethodGet); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Expected ErrInvalidURL, got %v", err)
+	}
+}
+
+func TestValidateURLsMaxURLLength(t *testing.T) {
+	long := "http://example.com/" + strings.Repeat("a", DefaultMaxURLLength)
+	ucds := ValidateURLs([]string{"http://example.com/abc", long})
+	if ucds[0].Err != nil || !errors.Is(ucds[1].Err, ErrURLTooLong) || len(ucds[1].Err.Error()) > 200 {
+		t.Errorf("Unexpected results with default max, errors: %v, %v", ucds[0].Err, ucds[1].Err)
+	}
+
+	ucds = ValidateURLs([]string{"http://example.com/abc", long}, WithMaxURLLength(20))
+	if !errors.Is(ucds[0].Err, ErrURLTooLong) || !errors.Is(ucds[1].Err, ErrURLTooLong) {
+		t.Errorf("Expected ErrURLTooLong, got %v, %v", ucds[0].Err, ucds[1].Err)
+	}
+
+	ucds = ValidateURLs([]string{long}, WithMaxURLLength(0))
+	if ucds[0].Err != nil {
+		t.Errorf("Expected no error with check disabled, got %v", ucds[0].Err)
+	}
+
+	if _, _, err := CollectURL(long, 1*time.Second, http.MethodGet); !errors.Is(err, ErrURLTooLong) {
+		t.Errorf("Expected ErrURLTooLong, got %v", err)
+	}
+}
+
+func TestCollectURLsURLRewrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	errNoRewrite := errors.New("no rewrite")
+	rewrite := func(urlIn string) (string, error) {
+		if strings.Contains(urlIn, "fail") {
+			return "", errNoRewrite
+		}
+		return strings.Replace(urlIn, "http://production.example.com", server.URL, 1), nil
+	}
+	urls := []string{"http://production.example.com/a", "http://production.example.com/fail"}
+	for _, ucd := range CollectURLs(urls, 1*time.Second, http.MethodGet, 2, WithURLRewrite(rewrite)) {
+		switch ucd.URL {
+		case urls[0]:
+			if ucd.Err != nil || string(ucd.Bytes) != "/a" || ucd.Response.Request.URL.Host != server.Listener.Addr().String() {
+				t.Errorf("Expected rewritten request, got %s, error: %v", ucd.Bytes, ucd.Err)
+			}
+		case urls[1]:
+			if !errors.Is(ucd.Err, errNoRewrite) {
+				t.Errorf("Expected rewrite error, got %v", ucd.Err)
+			}
+		default:
+			t.Errorf("Unexpected URL %s", ucd.URL)
+		}
+	}
+
+	// The rewritten URL is validated.
+	_, _, err := CollectURL(server.URL, 1*time.Second, http.MethodGet,
+		WithURLRewrite(func(string) (string, error) { return "ftp://example.com", nil }))
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Expected ErrInvalidURL, got %v", err)
+	}
+
+	// ValidateURLs also rewrites.
+	ucds := ValidateURLs(urls, WithURLRewrite(rewrite))
+	if ucds[0].URL != urls[0] || ucds[0].Err != nil || !errors.Is(ucds[1].Err, errNoRewrite) {
+		t.Errorf("Unexpected ValidateURLs results: %+v", ucds)
+	}
+}